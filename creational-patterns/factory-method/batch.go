@@ -0,0 +1,173 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+)
+
+type RecipientResult struct {
+	Recipient string
+	Receipt   Receipt
+	Err       error
+	// Skipped is set for a recipient that already appeared earlier in the
+	// batch. It is neither sent to again nor counted as a failure.
+	Skipped bool
+}
+
+type BatchResult struct {
+	Channel string
+	Results []RecipientResult
+}
+
+func (b BatchResult) Succeeded() int {
+	n := 0
+	for _, r := range b.Results {
+		if r.Err == nil && !r.Skipped {
+			n++
+		}
+	}
+	return n
+}
+
+func (b BatchResult) Failed() []RecipientResult {
+	var failed []RecipientResult
+	for _, r := range b.Results {
+		if r.Err != nil {
+			failed = append(failed, r)
+		}
+	}
+	return failed
+}
+
+func (b BatchResult) Skipped() []RecipientResult {
+	var skipped []RecipientResult
+	for _, r := range b.Results {
+		if r.Skipped {
+			skipped = append(skipped, r)
+		}
+	}
+	return skipped
+}
+
+// BatchSender sends one message to many recipients of a channel. Every
+// recipient goes through its channel's factory and, when Limiter is set,
+// takes a rate limit token, exactly as a single send would. Email and push
+// then use native multicast (BCC chunks of MaxBCC, one topic publish); SMS
+// fans out to Notification.Send over Concurrency workers.
+type BatchSender struct {
+	Channel     string
+	Limiter     *RateLimiter
+	MaxBCC      int
+	Topic       string
+	Concurrency int
+}
+
+func (s *BatchSender) SendBatch(recipients []string, message string) BatchResult {
+	result := BatchResult{Channel: s.Channel, Results: make([]RecipientResult, len(recipients))}
+	notifications := make(map[int]Notification, len(recipients))
+	var pending []int
+	seen := make(map[string]bool, len(recipients))
+	for i, recipient := range recipients {
+		r := &result.Results[i]
+		r.Recipient = recipient
+		if seen[recipient] {
+			r.Skipped = true
+			continue
+		}
+		seen[recipient] = true
+		notification, err := s.createNotification(recipient)
+		if err != nil {
+			r.Err = err
+			continue
+		}
+		notifications[i] = notification
+		pending = append(pending, i)
+	}
+
+	switch s.Channel {
+	case ChannelEmail, ChannelPush:
+		s.multicast(&result, notifications, pending, message)
+	default:
+		s.fanOut(&result, notifications, pending, message)
+	}
+	return result
+}
+
+func (s *BatchSender) createNotification(recipient string) (Notification, error) {
+	factory, err := NewNotificationFactory(s.Channel, recipient)
+	if err != nil {
+		return nil, err
+	}
+	if s.Limiter != nil {
+		factory = s.Limiter.Wrap(factory)
+	}
+	return factory.CreateNotification()
+}
+
+func (s *BatchSender) multicast(result *BatchResult, notifications map[int]Notification, pending []int, message string) {
+	var accepted []int
+	for _, i := range pending {
+		if limited, ok := notifications[i].(*rateLimitedNotification); ok {
+			if err := limited.acquire(); err != nil {
+				result.Results[i].Err = err
+				continue
+			}
+		}
+		accepted = append(accepted, i)
+	}
+	if len(accepted) == 0 {
+		return
+	}
+
+	chunk := len(accepted)
+	if s.Channel == ChannelEmail {
+		chunk = s.MaxBCC
+		if chunk <= 0 {
+			chunk = 50
+		}
+	}
+	for start := 0; start < len(accepted); start += chunk {
+		end := start + chunk
+		if end > len(accepted) {
+			end = len(accepted)
+		}
+		group := accepted[start:end]
+		if s.Channel == ChannelEmail {
+			fmt.Printf("[EMAIL] Sending to %d recipients via BCC: %s\n", len(group), message)
+		} else {
+			topic := s.Topic
+			if topic == "" {
+				topic = "broadcast"
+			}
+			fmt.Printf("[PUSH] Publishing to topic %s (%d devices): %s\n", topic, len(group), message)
+		}
+		for _, i := range group {
+			n := notifications[i]
+			result.Results[i].Receipt = newReceipt(n.GetType(), n.GetRecipient())
+		}
+	}
+}
+
+func (s *BatchSender) fanOut(result *BatchResult, notifications map[int]Notification, pending []int, message string) {
+	concurrency := s.Concurrency
+	if concurrency <= 0 {
+		concurrency = 8
+	}
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				r := &result.Results[i]
+				r.Receipt, r.Err = notifications[i].Send(message)
+			}
+		}()
+	}
+	for _, i := range pending {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+}
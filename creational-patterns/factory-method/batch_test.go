@@ -0,0 +1,35 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSendBatchSkipsDuplicatesAndAppliesLimiter(t *testing.T) {
+	limiter := NewRateLimiter(FailFast)
+	if err := limiter.SetChannelLimit(ChannelEmail, RateLimit{Rate: 1, Burst: 2}); err != nil {
+		t.Fatal(err)
+	}
+	sender := &BatchSender{Channel: ChannelEmail, Limiter: limiter, MaxBCC: 10}
+	result := sender.SendBatch([]string{"a@example.com", "a@example.com", "bad", "b@example.com", "c@example.com"}, "hi")
+
+	if got := result.Succeeded(); got != 2 {
+		t.Errorf("Succeeded() = %d, want 2", got)
+	}
+	if skipped := result.Skipped(); len(skipped) != 1 || skipped[0].Recipient != "a@example.com" {
+		t.Errorf("Skipped() = %+v, want the second a@example.com", skipped)
+	}
+	failed := result.Failed()
+	if len(failed) != 2 {
+		t.Fatalf("Failed() = %+v, want 2 entries", failed)
+	}
+	if !errors.Is(failed[0].Err, ErrInvalidRecipient) {
+		t.Errorf("bad: got %v, want ErrInvalidRecipient", failed[0].Err)
+	}
+	if !errors.Is(failed[1].Err, ErrRateLimited) {
+		t.Errorf("c@example.com: got %v, want ErrRateLimited", failed[1].Err)
+	}
+	if got := limiter.Metrics()[ChannelEmail]; got.Allowed != 2 || got.Rejected != 1 {
+		t.Errorf("limiter metrics = %+v, want 2 allowed and 1 rejected", got)
+	}
+}
@@ -1,98 +1,413 @@
 package main
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
 
 type Notification interface {
-	Send(message string) error
+	Send(message string) (Receipt, error)
 	GetType() string
+	GetRecipient() string
 }
 
 type EmailNotification struct {
 	recipient string
 }
 
-func (e *EmailNotification) Send(message string) error {
+func (e *EmailNotification) Send(message string) (Receipt, error) {
 	fmt.Printf("[EMAIL] Sending to %s: %s\n", e.recipient, message)
-	return nil
+	return newReceipt(e.GetType(), e.recipient), nil
 }
 
 func (e *EmailNotification) GetType() string {
 	return "Email"
 }
 
+func (e *EmailNotification) GetRecipient() string {
+	return e.recipient
+}
+
 type SMSNotification struct {
 	phoneNumber string
 }
 
-func (s *SMSNotification) Send(message string) error {
+func (s *SMSNotification) Send(message string) (Receipt, error) {
 	fmt.Printf("[SMS] Sending to %s: %s\n", s.phoneNumber, message)
-	return nil
+	return newReceipt(s.GetType(), s.phoneNumber), nil
 }
 
 func (s *SMSNotification) GetType() string {
 	return "SMS"
 }
 
+func (s *SMSNotification) GetRecipient() string {
+	return s.phoneNumber
+}
+
 type PushNotification struct {
 	deviceID string
 }
 
-func (p *PushNotification) Send(message string) error {
+func (p *PushNotification) Send(message string) (Receipt, error) {
 	fmt.Printf("[PUSH] Sending to device %s: %s\n", p.deviceID, message)
-	return nil
+	return newReceipt(p.GetType(), p.deviceID), nil
 }
 
 func (p *PushNotification) GetType() string {
 	return "Push"
 }
 
+func (p *PushNotification) GetRecipient() string {
+	return p.deviceID
+}
+
 type NotificationFactory interface {
-	CreateNotification() Notification
+	CreateNotification() (Notification, error)
 }
 
 type EmailNotificationFactory struct {
 	recipient string
 }
 
-func (f *EmailNotificationFactory) CreateNotification() Notification {
-	return &EmailNotification{recipient: f.recipient}
+func NewEmailNotificationFactory(recipient string) (*EmailNotificationFactory, error) {
+	if err := ValidateEmail(recipient); err != nil {
+		return nil, err
+	}
+	return &EmailNotificationFactory{recipient: recipient}, nil
+}
+
+func (f *EmailNotificationFactory) CreateNotification() (Notification, error) {
+	if err := ValidateEmail(f.recipient); err != nil {
+		return nil, err
+	}
+	return &EmailNotification{recipient: f.recipient}, nil
 }
 
 type SMSNotificationFactory struct {
 	phoneNumber string
 }
 
-func (f *SMSNotificationFactory) CreateNotification() Notification {
-	return &SMSNotification{phoneNumber: f.phoneNumber}
+func NewSMSNotificationFactory(phoneNumber string) (*SMSNotificationFactory, error) {
+	if err := ValidatePhoneNumber(phoneNumber); err != nil {
+		return nil, err
+	}
+	return &SMSNotificationFactory{phoneNumber: phoneNumber}, nil
+}
+
+func (f *SMSNotificationFactory) CreateNotification() (Notification, error) {
+	if err := ValidatePhoneNumber(f.phoneNumber); err != nil {
+		return nil, err
+	}
+	return &SMSNotification{phoneNumber: f.phoneNumber}, nil
 }
 
 type PushNotificationFactory struct {
 	deviceID string
 }
 
-func (f *PushNotificationFactory) CreateNotification() Notification {
-	return &PushNotification{deviceID: f.deviceID}
+func NewPushNotificationFactory(deviceID string) (*PushNotificationFactory, error) {
+	if err := ValidateDeviceID(deviceID); err != nil {
+		return nil, err
+	}
+	return &PushNotificationFactory{deviceID: deviceID}, nil
 }
 
-func sendNotification(factory NotificationFactory, message string) {
-	notification := factory.CreateNotification()
+func (f *PushNotificationFactory) CreateNotification() (Notification, error) {
+	if err := ValidateDeviceID(f.deviceID); err != nil {
+		return nil, err
+	}
+	return &PushNotification{deviceID: f.deviceID}, nil
+}
+
+func NewNotificationFactory(channel, recipient string) (NotificationFactory, error) {
+	switch channel {
+	case ChannelEmail:
+		return NewEmailNotificationFactory(recipient)
+	case ChannelSMS:
+		return NewSMSNotificationFactory(recipient)
+	case ChannelPush:
+		return NewPushNotificationFactory(recipient)
+	}
+	return nil, fmt.Errorf("unknown channel %q", channel)
+}
+
+func sendNotification(factory NotificationFactory, message string) (Receipt, error) {
+	notification, err := factory.CreateNotification()
+	if err != nil {
+		return Receipt{}, err
+	}
+	fmt.Printf("Created %s notification\n", notification.GetType())
+	return notification.Send(message)
+}
+
+// sendAndRecord sends through factory and records the outcome in statuses:
+// the receipt of a successful send, or a failed receipt if Send fails.
+func sendAndRecord(statuses *StatusStore, factory NotificationFactory, message string) (Receipt, error) {
+	notification, err := factory.CreateNotification()
+	if err != nil {
+		return Receipt{}, err
+	}
 	fmt.Printf("Created %s notification\n", notification.GetType())
-	notification.Send(message)
+	receipt, err := notification.Send(message)
+	if err != nil {
+		return statuses.RecordFailure(notification.GetType(), notification.GetRecipient(), err), err
+	}
+	return receipt, statuses.Record(receipt)
 }
 
 func main() {
-	fmt.Println("=== Factory Method Pattern Demo ===\n")
+	fmt.Println("=== Factory Method Pattern Demo ===")
+	fmt.Println()
+
+	statuses := NewStatusStore()
 
-	emailFactory := &EmailNotificationFactory{recipient: "user@example.com"}
-	sendNotification(emailFactory, "Your order has been shipped!")
+	emailFactory, err := NewEmailNotificationFactory("user@example.com")
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	emailReceipt, err := sendAndRecord(statuses, emailFactory, "Your order has been shipped!")
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
 
 	fmt.Println()
 
-	smsFactory := &SMSNotificationFactory{phoneNumber: "+1234567890"}
-	sendNotification(smsFactory, "Your verification code is 123456")
+	smsFactory, err := NewSMSNotificationFactory("+1234567890")
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	smsReceipt, err := sendAndRecord(statuses, smsFactory, "Your verification code is 123456")
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
 
 	fmt.Println()
 
-	pushFactory := &PushNotificationFactory{deviceID: "device-abc-123"}
-	sendNotification(pushFactory, "You have a new message")
+	pushFactory, err := NewPushNotificationFactory("device-abc-123")
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	pushReceipt, err := sendAndRecord(statuses, pushFactory, "You have a new message")
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+
+	fmt.Println()
+
+	limiter := NewRateLimiter(FailFast)
+	if err := limiter.SetChannelLimit(ChannelSMS, RateLimit{Rate: 1, Burst: 1}); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	limitedSMS := limiter.Wrap(smsFactory)
+	if _, err := sendAndRecord(statuses, limitedSMS, "Your order is out for delivery"); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	failedReceipt, err := sendAndRecord(statuses, limitedSMS, "Your order has arrived")
+	if err != nil {
+		fmt.Printf("Send failed: %v\n", err)
+	}
+
+	fmt.Println("\n--- Delivery Receipts ---")
+	callbacks := []DeliveryCallback{
+		{MessageID: emailReceipt.ID, Status: StatusDelivered},
+		{MessageID: emailReceipt.ID, Status: StatusRead},
+		{MessageID: smsReceipt.ID, Status: StatusBounced, Detail: "carrier rejected number"},
+		{MessageID: pushReceipt.ID, Status: StatusDelivered},
+		{MessageID: smsReceipt.ID, Status: StatusDelivered},
+	}
+	for _, cb := range callbacks {
+		if err := statuses.Apply(cb); err != nil {
+			fmt.Printf("Callback rejected: %v\n", err)
+		}
+	}
+	for _, id := range []string{emailReceipt.ID, smsReceipt.ID, pushReceipt.ID, failedReceipt.ID} {
+		receipt, err := statuses.Get(id)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			continue
+		}
+		fmt.Println(receipt)
+	}
+
+	fmt.Println("\n--- Recipient Validation ---")
+	if _, err := NewEmailNotificationFactory("not-an-email"); err != nil {
+		fmt.Printf("Rejected: %v\n", err)
+	}
+	if _, err := NewSMSNotificationFactory("555-0100"); err != nil {
+		fmt.Printf("Rejected: %v\n", err)
+	}
+	if _, err := NewPushNotificationFactory("abc"); err != nil {
+		fmt.Printf("Rejected: %v\n", err)
+	}
+	unchecked := &SMSNotificationFactory{phoneNumber: "12345"}
+	if _, err := sendNotification(unchecked, "Never sent"); err != nil {
+		fmt.Printf("Rejected: %v\n", err)
+	}
+
+	fmt.Println("\n--- Rate Limiting ---")
+	demoRateLimiting()
+
+	fmt.Println("\n--- Batch and Multicast Sends ---")
+	demoBatch()
+
+	fmt.Println("\n--- Preference-Based Routing ---")
+	demoRouting()
+}
+
+func demoRateLimiting() {
+	failFast := NewRateLimiter(FailFast)
+	if err := failFast.SetChannelLimit(ChannelSMS, RateLimit{Rate: 1, Burst: 2}); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	smsFactory, err := NewSMSNotificationFactory("+14155550100")
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	limitedSMS := failFast.Wrap(smsFactory)
+	for i := 1; i <= 3; i++ {
+		if _, err := sendNotification(limitedSMS, fmt.Sprintf("Alert %d", i)); errors.Is(err, ErrRateLimited) {
+			fmt.Println("Rejected: SMS rate limit exceeded")
+		}
+	}
+
+	blocking := NewRateLimiter(Blocking)
+	if err := blocking.SetRecipientLimit(ChannelPush, RateLimit{Rate: 20, Burst: 1}); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	pushFactory, err := NewPushNotificationFactory("device-abc-123")
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	limitedPush := blocking.Wrap(pushFactory)
+	for i := 1; i <= 3; i++ {
+		if _, err := sendNotification(limitedPush, fmt.Sprintf("Update %d", i)); err != nil {
+			fmt.Printf("Error: %v\n", err)
+		}
+	}
+
+	for _, line := range append(failFast.MetricsReport(), blocking.MetricsReport()...) {
+		fmt.Println(line)
+	}
+}
+
+func demoBatch() {
+	limiter := NewRateLimiter(FailFast)
+	if err := limiter.SetChannelLimit(ChannelSMS, RateLimit{Rate: 1, Burst: 1}); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	batches := []struct {
+		sender     *BatchSender
+		recipients []string
+	}{
+		{&BatchSender{Channel: ChannelEmail, MaxBCC: 2}, []string{"a@example.com", "b@example.com", "c@example.com", "not-an-email"}},
+		{&BatchSender{Channel: ChannelPush, Topic: "announcements"}, []string{"device-abc-123", "device-def-456", "device-abc-123"}},
+		{&BatchSender{Channel: ChannelSMS, Limiter: limiter, Concurrency: 1}, []string{"+14155550100", "+442071838750", "0800-FLOWERS"}},
+	}
+	for _, b := range batches {
+		result := b.sender.SendBatch(b.recipients, "Service update: new features are live")
+		fmt.Printf("%s batch: %d sent, %d failed, %d skipped\n", result.Channel, result.Succeeded(), len(result.Failed()), len(result.Skipped()))
+		for _, failed := range result.Failed() {
+			fmt.Printf("  failed: %v\n", failed.Err)
+		}
+		for _, skipped := range result.Skipped() {
+			fmt.Printf("  skipped duplicate: %s\n", skipped.Recipient)
+		}
+	}
+}
+
+func demoRouting() {
+	dir, err := os.MkdirTemp("", "notification-prefs")
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	store, err := OpenJSONFilePreferenceStore(filepath.Join(dir, "preferences.json"))
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	users := []Preferences{
+		{
+			UserID:   "alice",
+			Email:    "alice@example.com",
+			Phone:    "+14155550100",
+			DeviceID: "device-alice-01",
+			Channels: []string{ChannelEmail, ChannelSMS, ChannelPush},
+		},
+		{
+			UserID:     "bob",
+			Email:      "bob@example.com",
+			Phone:      "+442071838750",
+			Channels:   []string{ChannelEmail, ChannelSMS},
+			QuietHours: &QuietHours{Start: "22:00", End: "07:00", Timezone: "UTC"},
+		},
+	}
+	for _, prefs := range users {
+		if err := store.Put(prefs); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+	}
+
+	router := NewNotificationRouter(store)
+	router.SetClock(func() time.Time { return time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC) })
+
+	if _, err := HandleSMSReply(store, "+14155550100", "STOP", time.Date(2024, 2, 28, 9, 30, 0, 0, time.UTC)); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+
+	reopened, err := OpenJSONFilePreferenceStore(filepath.Join(dir, "preferences.json"))
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	alice, err := reopened.Get("alice")
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	fmt.Printf("Reloaded preferences: alice opted out of SMS: %v\n", alice.OptedOut(ChannelSMS))
+
+	for _, userID := range []string{"alice", "bob"} {
+		report, err := router.Dispatch(userID, "Scheduled maintenance tonight")
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			continue
+		}
+		fmt.Printf("%s: %d receipt(s)\n", userID, len(report.Receipts))
+		for _, s := range report.Suppressed {
+			fmt.Println(s)
+		}
+	}
+
+	fmt.Println("\nAt 23:00 UTC bob is in quiet hours:")
+	router.SetClock(func() time.Time { return time.Date(2024, 3, 1, 23, 0, 0, 0, time.UTC) })
+	report, err := router.Dispatch("bob", "Scheduled maintenance tonight")
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	for _, s := range report.Suppressed {
+		fmt.Println(s)
+	}
 }
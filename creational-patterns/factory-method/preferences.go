@@ -0,0 +1,320 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	ChannelEmail = "Email"
+	ChannelSMS   = "SMS"
+	ChannelPush  = "Push"
+)
+
+var ErrUnknownUser = errors.New("unknown user")
+
+type QuietHours struct {
+	Start    string `json:"start"`
+	End      string `json:"end"`
+	Timezone string `json:"timezone,omitempty"`
+}
+
+func (q *QuietHours) Contains(t time.Time) (bool, error) {
+	start, err := parseClock(q.Start)
+	if err != nil {
+		return false, err
+	}
+	end, err := parseClock(q.End)
+	if err != nil {
+		return false, err
+	}
+	if q.Timezone != "" {
+		loc, err := time.LoadLocation(q.Timezone)
+		if err != nil {
+			return false, fmt.Errorf("quiet hours: %w", err)
+		}
+		t = t.In(loc)
+	}
+	now := t.Hour()*60 + t.Minute()
+	if start <= end {
+		return now >= start && now < end, nil
+	}
+	return now >= start || now < end, nil
+}
+
+func parseClock(value string) (int, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("quiet hours: invalid time %q, expected HH:MM", value)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+type OptOut struct {
+	At     time.Time `json:"at"`
+	Source string    `json:"source"`
+}
+
+type Preferences struct {
+	UserID     string            `json:"user_id"`
+	Email      string            `json:"email,omitempty"`
+	Phone      string            `json:"phone,omitempty"`
+	DeviceID   string            `json:"device_id,omitempty"`
+	Channels   []string          `json:"channels"`
+	QuietHours *QuietHours       `json:"quiet_hours,omitempty"`
+	OptOuts    map[string]OptOut `json:"opt_outs,omitempty"`
+}
+
+func (p Preferences) Allows(channel string) bool {
+	for _, c := range p.Channels {
+		if c == channel {
+			return true
+		}
+	}
+	return false
+}
+
+func (p Preferences) Contact(channel string) string {
+	switch channel {
+	case ChannelEmail:
+		return p.Email
+	case ChannelSMS:
+		return p.Phone
+	case ChannelPush:
+		return p.DeviceID
+	}
+	return ""
+}
+
+func (p Preferences) OptedOut(channel string) bool {
+	_, ok := p.OptOuts[channel]
+	return ok
+}
+
+func (p Preferences) clone() Preferences {
+	p.Channels = append([]string(nil), p.Channels...)
+	if p.QuietHours != nil {
+		q := *p.QuietHours
+		p.QuietHours = &q
+	}
+	if p.OptOuts != nil {
+		optOuts := make(map[string]OptOut, len(p.OptOuts))
+		for k, v := range p.OptOuts {
+			optOuts[k] = v
+		}
+		p.OptOuts = optOuts
+	}
+	return p
+}
+
+type PreferenceStore interface {
+	Get(userID string) (Preferences, error)
+	Put(prefs Preferences) error
+	FindByPhone(phone string) (Preferences, error)
+	// Update and UpdateByPhone apply fn to a copy of the stored preferences
+	// and save the result, all under the store's lock, so concurrent
+	// updates are never lost. Nothing is saved if fn returns an error.
+	Update(userID string, fn func(*Preferences) error) error
+	UpdateByPhone(phone string, fn func(*Preferences) error) error
+}
+
+type MemoryPreferenceStore struct {
+	mu    sync.RWMutex
+	users map[string]Preferences
+	// persist, when set, is called with the write lock held after every
+	// change. If it fails the change is rolled back.
+	persist func(users []Preferences) error
+}
+
+func NewMemoryPreferenceStore() *MemoryPreferenceStore {
+	return &MemoryPreferenceStore{users: make(map[string]Preferences)}
+}
+
+func (s *MemoryPreferenceStore) Get(userID string) (Preferences, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	prefs, ok := s.users[userID]
+	if !ok {
+		return Preferences{}, fmt.Errorf("%w: %s", ErrUnknownUser, userID)
+	}
+	return prefs.clone(), nil
+}
+
+func (s *MemoryPreferenceStore) Put(prefs Preferences) error {
+	if prefs.UserID == "" {
+		return errors.New("preferences: user ID is required")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.commitLocked(prefs)
+}
+
+func (s *MemoryPreferenceStore) FindByPhone(phone string) (Preferences, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	prefs, err := s.findByPhoneLocked(phone)
+	if err != nil {
+		return Preferences{}, err
+	}
+	return prefs.clone(), nil
+}
+
+func (s *MemoryPreferenceStore) Update(userID string, fn func(*Preferences) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	prefs, ok := s.users[userID]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownUser, userID)
+	}
+	return s.applyLocked(prefs, fn)
+}
+
+func (s *MemoryPreferenceStore) UpdateByPhone(phone string, fn func(*Preferences) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	prefs, err := s.findByPhoneLocked(phone)
+	if err != nil {
+		return err
+	}
+	return s.applyLocked(prefs, fn)
+}
+
+func (s *MemoryPreferenceStore) findByPhoneLocked(phone string) (Preferences, error) {
+	for _, prefs := range s.users {
+		if prefs.Phone == phone {
+			return prefs, nil
+		}
+	}
+	return Preferences{}, fmt.Errorf("%w: no user with phone %s", ErrUnknownUser, phone)
+}
+
+func (s *MemoryPreferenceStore) applyLocked(prefs Preferences, fn func(*Preferences) error) error {
+	updated := prefs.clone()
+	if err := fn(&updated); err != nil {
+		return err
+	}
+	if updated.UserID != prefs.UserID {
+		return errors.New("preferences: Update cannot change the user ID")
+	}
+	return s.commitLocked(updated)
+}
+
+func (s *MemoryPreferenceStore) commitLocked(prefs Preferences) error {
+	prev, existed := s.users[prefs.UserID]
+	s.users[prefs.UserID] = prefs.clone()
+	if s.persist == nil {
+		return nil
+	}
+	if err := s.persist(s.snapshotLocked()); err != nil {
+		if existed {
+			s.users[prefs.UserID] = prev
+		} else {
+			delete(s.users, prefs.UserID)
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *MemoryPreferenceStore) snapshotLocked() []Preferences {
+	all := make([]Preferences, 0, len(s.users))
+	for _, prefs := range s.users {
+		all = append(all, prefs.clone())
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].UserID < all[j].UserID })
+	return all
+}
+
+// JSONFilePreferenceStore is a MemoryPreferenceStore that rewrites its file
+// after every change, under the same lock as the change itself.
+type JSONFilePreferenceStore struct {
+	*MemoryPreferenceStore
+	path string
+}
+
+func OpenJSONFilePreferenceStore(path string) (*JSONFilePreferenceStore, error) {
+	store := &JSONFilePreferenceStore{
+		MemoryPreferenceStore: NewMemoryPreferenceStore(),
+		path:                  path,
+	}
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if err == nil {
+		var users []Preferences
+		if err := json.Unmarshal(data, &users); err != nil {
+			return nil, fmt.Errorf("preferences: parsing %s: %w", path, err)
+		}
+		for _, prefs := range users {
+			if err := store.Put(prefs); err != nil {
+				return nil, err
+			}
+		}
+	}
+	store.persist = store.write
+	return store, nil
+}
+
+func (s *JSONFilePreferenceStore) write(users []Preferences) error {
+	data, err := json.MarshalIndent(users, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), ".preferences-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
+
+var (
+	smsOptOutKeywords = []string{"STOP", "STOPALL", "UNSUBSCRIBE", "CANCEL", "END", "QUIT"}
+	smsOptInKeywords  = []string{"START", "UNSTOP", "YES"}
+)
+
+// HandleSMSReply applies the carrier keywords that US and EU SMS compliance
+// rules require us to honour. It reports whether the reply was a keyword.
+func HandleSMSReply(store PreferenceStore, phone, body string, at time.Time) (bool, error) {
+	keyword := strings.ToUpper(strings.TrimSpace(body))
+	optOut, optIn := containsString(smsOptOutKeywords, keyword), containsString(smsOptInKeywords, keyword)
+	if !optOut && !optIn {
+		return false, nil
+	}
+	err := store.UpdateByPhone(phone, func(prefs *Preferences) error {
+		if optOut {
+			if prefs.OptOuts == nil {
+				prefs.OptOuts = make(map[string]OptOut)
+			}
+			prefs.OptOuts[ChannelSMS] = OptOut{At: at, Source: "sms-reply:" + keyword}
+		} else {
+			delete(prefs.OptOuts, ChannelSMS)
+		}
+		return nil
+	})
+	return true, err
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
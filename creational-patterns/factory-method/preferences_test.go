@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHandleSMSReplyConcurrentUpdates(t *testing.T) {
+	store, err := OpenJSONFilePreferenceStore(filepath.Join(t.TempDir(), "preferences.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	const users = 20
+	for i := 0; i < users; i++ {
+		prefs := Preferences{UserID: fmt.Sprintf("user-%d", i), Phone: fmt.Sprintf("+1415555%04d", i)}
+		if err := store.Put(prefs); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Each user replies STOP while another goroutine updates an unrelated
+	// field; neither update may overwrite the other.
+	var wg sync.WaitGroup
+	for i := 0; i < users; i++ {
+		i := i
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if _, err := HandleSMSReply(store, fmt.Sprintf("+1415555%04d", i), "STOP", time.Now()); err != nil {
+				t.Error(err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			err := store.Update(fmt.Sprintf("user-%d", i), func(prefs *Preferences) error {
+				prefs.Email = fmt.Sprintf("user-%d@example.com", i)
+				return nil
+			})
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	reopened, err := OpenJSONFilePreferenceStore(store.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < users; i++ {
+		prefs, err := reopened.Get(fmt.Sprintf("user-%d", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := prefs.OptOuts[ChannelSMS]; !ok {
+			t.Errorf("%s: SMS opt-out was lost", prefs.UserID)
+		}
+		if prefs.Email == "" {
+			t.Errorf("%s: email update was lost", prefs.UserID)
+		}
+	}
+}
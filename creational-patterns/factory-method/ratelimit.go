@@ -0,0 +1,288 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrRateLimited      = errors.New("rate limit exceeded")
+	ErrInvalidRateLimit = errors.New("invalid rate limit")
+)
+
+type RateLimitMode int
+
+const (
+	FailFast RateLimitMode = iota
+	Blocking
+)
+
+type RateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+type tokenBucket struct {
+	limit  RateLimit
+	tokens float64
+	last   time.Time
+}
+
+func (r RateLimit) validate() error {
+	if r.Rate <= 0 || math.IsNaN(r.Rate) || math.IsInf(r.Rate, 0) {
+		return fmt.Errorf("%w: rate must be a positive number, got %v", ErrInvalidRateLimit, r.Rate)
+	}
+	if r.Burst < 1 {
+		return fmt.Errorf("%w: burst must be at least 1, got %d", ErrInvalidRateLimit, r.Burst)
+	}
+	return nil
+}
+
+func newTokenBucket(limit RateLimit, now time.Time) *tokenBucket {
+	return &tokenBucket{limit: limit, tokens: float64(limit.Burst), last: now}
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens += elapsed * b.limit.Rate
+		if b.tokens > float64(b.limit.Burst) {
+			b.tokens = float64(b.limit.Burst)
+		}
+	}
+	b.last = now
+}
+
+// idle reports whether the bucket has refilled to its burst by now, which
+// makes it no different from a new bucket.
+func (b *tokenBucket) idle(now time.Time) bool {
+	return b.tokens+now.Sub(b.last).Seconds()*b.limit.Rate >= float64(b.limit.Burst)
+}
+
+func (b *tokenBucket) wait(now time.Time) time.Duration {
+	b.refill(now)
+	if b.tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - b.tokens) / b.limit.Rate * float64(time.Second))
+}
+
+type RateLimitStats struct {
+	Allowed   int
+	Rejected  int
+	Delayed   int
+	TotalWait time.Duration
+}
+
+func (s RateLimitStats) LimitHits() int {
+	return s.Rejected + s.Delayed
+}
+
+type RateLimiter struct {
+	mu               sync.Mutex
+	mode             RateLimitMode
+	maxWait          time.Duration
+	channelLimits    map[string]RateLimit
+	recipientLimits  map[string]RateLimit
+	channelBuckets   map[string]*tokenBucket
+	recipientBuckets map[string]*tokenBucket
+	lastSweep        time.Time
+	stats            map[string]*RateLimitStats
+	now              func() time.Time
+	sleep            func(time.Duration)
+}
+
+func NewRateLimiter(mode RateLimitMode) *RateLimiter {
+	return &RateLimiter{
+		mode:             mode,
+		maxWait:          time.Minute,
+		channelLimits:    make(map[string]RateLimit),
+		recipientLimits:  make(map[string]RateLimit),
+		channelBuckets:   make(map[string]*tokenBucket),
+		recipientBuckets: make(map[string]*tokenBucket),
+		stats:            make(map[string]*RateLimitStats),
+		now:              time.Now,
+		sleep:            time.Sleep,
+	}
+}
+
+func (l *RateLimiter) SetChannelLimit(channel string, limit RateLimit) error {
+	if err := limit.validate(); err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.channelLimits[channel] = limit
+	delete(l.channelBuckets, channel)
+	return nil
+}
+
+func (l *RateLimiter) SetRecipientLimit(channel string, limit RateLimit) error {
+	if err := limit.validate(); err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.recipientLimits[channel] = limit
+	for key := range l.recipientBuckets {
+		if strings.HasPrefix(key, channel+"/") {
+			delete(l.recipientBuckets, key)
+		}
+	}
+	return nil
+}
+
+func (l *RateLimiter) SetMaxWait(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.maxWait = d
+}
+
+func (l *RateLimiter) Wrap(factory NotificationFactory) NotificationFactory {
+	return &rateLimitedFactory{factory: factory, limiter: l}
+}
+
+func (l *RateLimiter) Acquire(channel, recipient string) error {
+	var waited time.Duration
+	for {
+		wait, err := l.tryAcquire(channel, recipient, waited)
+		if err != nil || wait == 0 {
+			return err
+		}
+		l.sleep(wait)
+		waited += wait
+	}
+}
+
+func (l *RateLimiter) tryAcquire(channel, recipient string, waited time.Duration) (time.Duration, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	stats := l.statsFor(channel)
+	l.evictIdle(now)
+
+	var buckets []*tokenBucket
+	if limit, ok := l.channelLimits[channel]; ok {
+		buckets = append(buckets, l.bucket(l.channelBuckets, channel, limit, now))
+	}
+	if limit, ok := l.recipientLimits[channel]; ok {
+		buckets = append(buckets, l.bucket(l.recipientBuckets, channel+"/"+recipient, limit, now))
+	}
+
+	var wait time.Duration
+	for _, b := range buckets {
+		wait = max(wait, b.wait(now))
+	}
+	if wait == 0 {
+		for _, b := range buckets {
+			b.tokens--
+		}
+		stats.Allowed++
+		if waited > 0 {
+			stats.Delayed++
+			stats.TotalWait += waited
+		}
+		return 0, nil
+	}
+	if l.mode == FailFast || waited+wait > l.maxWait {
+		stats.Rejected++
+		return 0, fmt.Errorf("%w: %s to %s, retry in %s", ErrRateLimited, channel, recipient, wait.Round(time.Millisecond))
+	}
+	return wait, nil
+}
+
+// idleSweepInterval is how often tryAcquire looks for idle recipient
+// buckets to drop.
+const idleSweepInterval = time.Minute
+
+// evictIdle drops the recipient buckets that have refilled, so the map does
+// not keep a bucket for every recipient ever sent to. A dropped bucket is
+// recreated full on the recipient's next send, which is the state it was in.
+func (l *RateLimiter) evictIdle(now time.Time) {
+	if now.Sub(l.lastSweep) < idleSweepInterval {
+		return
+	}
+	l.lastSweep = now
+	for key, b := range l.recipientBuckets {
+		if b.idle(now) {
+			delete(l.recipientBuckets, key)
+		}
+	}
+}
+
+func (l *RateLimiter) bucket(buckets map[string]*tokenBucket, key string, limit RateLimit, now time.Time) *tokenBucket {
+	b, ok := buckets[key]
+	if !ok {
+		b = newTokenBucket(limit, now)
+		buckets[key] = b
+	}
+	return b
+}
+
+func (l *RateLimiter) statsFor(channel string) *RateLimitStats {
+	s, ok := l.stats[channel]
+	if !ok {
+		s = &RateLimitStats{}
+		l.stats[channel] = s
+	}
+	return s
+}
+
+func (l *RateLimiter) Metrics() map[string]RateLimitStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	result := make(map[string]RateLimitStats, len(l.stats))
+	for channel, s := range l.stats {
+		result[channel] = *s
+	}
+	return result
+}
+
+func (l *RateLimiter) MetricsReport() []string {
+	metrics := l.Metrics()
+	channels := make([]string, 0, len(metrics))
+	for channel := range metrics {
+		channels = append(channels, channel)
+	}
+	sort.Strings(channels)
+	lines := make([]string, 0, len(channels))
+	for _, channel := range channels {
+		s := metrics[channel]
+		lines = append(lines, fmt.Sprintf("%s: allowed=%d rejected=%d delayed=%d limit_hits=%d",
+			channel, s.Allowed, s.Rejected, s.Delayed, s.LimitHits()))
+	}
+	return lines
+}
+
+type rateLimitedFactory struct {
+	factory NotificationFactory
+	limiter *RateLimiter
+}
+
+func (f *rateLimitedFactory) CreateNotification() (Notification, error) {
+	notification, err := f.factory.CreateNotification()
+	if err != nil {
+		return nil, err
+	}
+	return &rateLimitedNotification{Notification: notification, limiter: f.limiter}, nil
+}
+
+type rateLimitedNotification struct {
+	Notification
+	limiter *RateLimiter
+}
+
+func (n *rateLimitedNotification) Send(message string) (Receipt, error) {
+	if err := n.acquire(); err != nil {
+		return Receipt{}, err
+	}
+	return n.Notification.Send(message)
+}
+
+func (n *rateLimitedNotification) acquire() error {
+	return n.limiter.Acquire(n.GetType(), n.GetRecipient())
+}
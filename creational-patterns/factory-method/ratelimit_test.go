@@ -0,0 +1,189 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"testing"
+	"time"
+)
+
+// fakeClock replaces the limiter's clock; sleeping advances it.
+type fakeClock struct {
+	now   time.Time
+	slept []time.Duration
+}
+
+func newFakeClock(l *RateLimiter) *fakeClock {
+	c := &fakeClock{now: time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)}
+	l.now = func() time.Time { return c.now }
+	l.sleep = func(d time.Duration) {
+		c.slept = append(c.slept, d)
+		c.now = c.now.Add(d)
+	}
+	return c
+}
+
+func TestRateLimiterRejectsInvalidLimits(t *testing.T) {
+	tests := []struct {
+		name  string
+		limit RateLimit
+		valid bool
+	}{
+		{"valid", RateLimit{Rate: 1, Burst: 1}, true},
+		{"fractional rate", RateLimit{Rate: 0.5, Burst: 3}, true},
+		{"zero burst", RateLimit{Rate: 1, Burst: 0}, false},
+		{"negative burst", RateLimit{Rate: 1, Burst: -1}, false},
+		{"zero rate", RateLimit{Rate: 0, Burst: 1}, false},
+		{"negative rate", RateLimit{Rate: -2, Burst: 1}, false},
+		{"NaN rate", RateLimit{Rate: math.NaN(), Burst: 1}, false},
+		{"infinite rate", RateLimit{Rate: math.Inf(1), Burst: 1}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter := NewRateLimiter(FailFast)
+			for _, set := range []func(string, RateLimit) error{limiter.SetChannelLimit, limiter.SetRecipientLimit} {
+				err := set(ChannelSMS, tt.limit)
+				if tt.valid && err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				if !tt.valid && !errors.Is(err, ErrInvalidRateLimit) {
+					t.Errorf("got %v, want ErrInvalidRateLimit", err)
+				}
+			}
+		})
+	}
+}
+
+func TestRateLimiterRefillsTokens(t *testing.T) {
+	limiter := NewRateLimiter(FailFast)
+	clock := newFakeClock(limiter)
+	if err := limiter.SetChannelLimit(ChannelSMS, RateLimit{Rate: 2, Burst: 2}); err != nil {
+		t.Fatal(err)
+	}
+	acquire := func(want error) {
+		t.Helper()
+		if err := limiter.Acquire(ChannelSMS, "+14155550100"); !errors.Is(err, want) {
+			t.Fatalf("at %s: got %v, want %v", clock.now.Format(time.TimeOnly), err, want)
+		}
+	}
+
+	acquire(nil)
+	acquire(nil)
+	acquire(ErrRateLimited)
+	clock.now = clock.now.Add(500 * time.Millisecond)
+	acquire(nil)
+	acquire(ErrRateLimited)
+	clock.now = clock.now.Add(time.Hour)
+	acquire(nil)
+	acquire(nil)
+	acquire(ErrRateLimited)
+	if len(clock.slept) != 0 {
+		t.Errorf("FailFast slept %v", clock.slept)
+	}
+
+	want := RateLimitStats{Allowed: 5, Rejected: 3}
+	if got := limiter.Metrics()[ChannelSMS]; got != want || got.LimitHits() != 3 {
+		t.Errorf("Metrics = %+v, want %+v", got, want)
+	}
+}
+
+func TestRateLimiterBlockingWaitsUpToMaxWait(t *testing.T) {
+	limiter := NewRateLimiter(Blocking)
+	clock := newFakeClock(limiter)
+	limiter.SetMaxWait(1500 * time.Millisecond)
+	if err := limiter.SetChannelLimit(ChannelSMS, RateLimit{Rate: 1, Burst: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := limiter.SetChannelLimit(ChannelPush, RateLimit{Rate: 0.5, Burst: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if err := limiter.Acquire(ChannelSMS, "+14155550100"); err != nil {
+			t.Fatalf("SMS send %d: %v", i+1, err)
+		}
+	}
+	if fmt.Sprint(clock.slept) != "[1s 1s]" {
+		t.Errorf("slept %v, want [1s 1s]", clock.slept)
+	}
+
+	clock.slept = nil
+	if err := limiter.Acquire(ChannelPush, "device-token-abc123"); err != nil {
+		t.Fatal(err)
+	}
+	if err := limiter.Acquire(ChannelPush, "device-token-abc123"); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("a 2s wait over a 1.5s maximum: got %v, want ErrRateLimited", err)
+	}
+	if len(clock.slept) != 0 {
+		t.Errorf("slept %v before rejecting a wait over the maximum", clock.slept)
+	}
+
+	metrics := limiter.Metrics()
+	if want := (RateLimitStats{Allowed: 3, Delayed: 2, TotalWait: 2 * time.Second}); metrics[ChannelSMS] != want {
+		t.Errorf("SMS metrics = %+v, want %+v", metrics[ChannelSMS], want)
+	}
+	if want := (RateLimitStats{Allowed: 1, Rejected: 1}); metrics[ChannelPush] != want {
+		t.Errorf("push metrics = %+v, want %+v", metrics[ChannelPush], want)
+	}
+	report := fmt.Sprint(limiter.MetricsReport())
+	if want := "[Push: allowed=1 rejected=1 delayed=0 limit_hits=1 SMS: allowed=3 rejected=0 delayed=2 limit_hits=2]"; report != want {
+		t.Errorf("MetricsReport = %s, want %s", report, want)
+	}
+}
+
+func TestRateLimiterLimitsEachRecipient(t *testing.T) {
+	limiter := NewRateLimiter(FailFast)
+	newFakeClock(limiter)
+	if err := limiter.SetRecipientLimit(ChannelSMS, RateLimit{Rate: 1, Burst: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := limiter.Acquire(ChannelSMS, "+14155550100"); err != nil {
+		t.Fatal(err)
+	}
+	if err := limiter.Acquire(ChannelSMS, "+14155550100"); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("second send to the same recipient: got %v", err)
+	}
+	if err := limiter.Acquire(ChannelSMS, "+442071838750"); err != nil {
+		t.Errorf("another recipient was limited: %v", err)
+	}
+	if err := limiter.Acquire(ChannelEmail, "+14155550100"); err != nil {
+		t.Errorf("a channel without limits was limited: %v", err)
+	}
+}
+
+func TestRateLimiterEvictsIdleRecipientBuckets(t *testing.T) {
+	limiter := NewRateLimiter(FailFast)
+	clock := newFakeClock(limiter)
+	if err := limiter.SetRecipientLimit(ChannelSMS, RateLimit{Rate: 1, Burst: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if err := limiter.SetRecipientLimit(ChannelPush, RateLimit{Rate: 0.001, Burst: 1}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		if err := limiter.Acquire(ChannelSMS, fmt.Sprintf("+1415555%04d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := limiter.Acquire(ChannelPush, "device-token-abc123"); err != nil {
+		t.Fatal(err)
+	}
+
+	clock.now = clock.now.Add(2 * idleSweepInterval)
+	if err := limiter.Acquire(ChannelSMS, "+14155550000"); err != nil {
+		t.Fatal(err)
+	}
+	if len(limiter.recipientBuckets) != 2 {
+		t.Errorf("%d recipient buckets left, want the push bucket that is still refilling and the one just used", len(limiter.recipientBuckets))
+	}
+	if err := limiter.Acquire(ChannelPush, "device-token-abc123"); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("a bucket still refilling was evicted: got %v", err)
+	}
+	if err := limiter.Acquire(ChannelSMS, "+14155550000"); err != nil {
+		t.Errorf("burst of 2 not kept after eviction: %v", err)
+	}
+	if err := limiter.Acquire(ChannelSMS, "+14155550000"); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("third send within the same instant: got %v", err)
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type DeliveryStatus string
+
+const (
+	StatusSent      DeliveryStatus = "sent"
+	StatusDelivered DeliveryStatus = "delivered"
+	StatusRead      DeliveryStatus = "read"
+	StatusBounced   DeliveryStatus = "bounced"
+	StatusFailed    DeliveryStatus = "failed"
+)
+
+var statusTransitions = map[DeliveryStatus][]DeliveryStatus{
+	StatusSent:      {StatusDelivered, StatusBounced, StatusFailed},
+	StatusDelivered: {StatusRead},
+}
+
+var (
+	ErrUnknownMessage    = errors.New("unknown message")
+	ErrInvalidTransition = errors.New("invalid status transition")
+)
+
+type Receipt struct {
+	ID        string
+	Channel   string
+	Recipient string
+	Timestamp time.Time
+	Status    DeliveryStatus
+}
+
+func (r Receipt) String() string {
+	return fmt.Sprintf("%s [%s to %s] %s", r.ID, r.Channel, r.Recipient, r.Status)
+}
+
+var messageSequence atomic.Uint64
+
+func newReceipt(channel, recipient string) Receipt {
+	return Receipt{
+		ID:        fmt.Sprintf("%s-%06d", strings.ToLower(channel), messageSequence.Add(1)),
+		Channel:   channel,
+		Recipient: recipient,
+		Timestamp: time.Now(),
+		Status:    StatusSent,
+	}
+}
+
+type DeliveryCallback struct {
+	MessageID string
+	Status    DeliveryStatus
+	At        time.Time
+	Detail    string
+}
+
+type StatusEvent struct {
+	Status DeliveryStatus
+	At     time.Time
+	Detail string
+}
+
+type statusRecord struct {
+	receipt Receipt
+	history []StatusEvent
+}
+
+type StatusStore struct {
+	mu       sync.RWMutex
+	messages map[string]*statusRecord
+}
+
+func NewStatusStore() *StatusStore {
+	return &StatusStore{messages: make(map[string]*statusRecord)}
+}
+
+func (s *StatusStore) Record(receipt Receipt) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.messages[receipt.ID]; exists {
+		return fmt.Errorf("status store: message %s already recorded", receipt.ID)
+	}
+	s.messages[receipt.ID] = &statusRecord{
+		receipt: receipt,
+		history: []StatusEvent{{Status: receipt.Status, At: receipt.Timestamp}},
+	}
+	return nil
+}
+
+// RecordFailure records a message whose Send returned cause, so it is
+// tracked as failed from the start instead of being lost. The receipt it
+// returns carries a new message ID.
+func (s *StatusStore) RecordFailure(channel, recipient string, cause error) Receipt {
+	receipt := newReceipt(channel, recipient)
+	receipt.Status = StatusFailed
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messages[receipt.ID] = &statusRecord{
+		receipt: receipt,
+		history: []StatusEvent{{Status: StatusFailed, At: receipt.Timestamp, Detail: cause.Error()}},
+	}
+	return receipt
+}
+
+func (s *StatusStore) Apply(cb DeliveryCallback) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	record, ok := s.messages[cb.MessageID]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownMessage, cb.MessageID)
+	}
+	current := record.receipt.Status
+	if !containsStatus(statusTransitions[current], cb.Status) {
+		return fmt.Errorf("%w: %s cannot move from %s to %s", ErrInvalidTransition, cb.MessageID, current, cb.Status)
+	}
+	if cb.At.IsZero() {
+		cb.At = time.Now()
+	}
+	record.receipt.Status = cb.Status
+	record.history = append(record.history, StatusEvent{Status: cb.Status, At: cb.At, Detail: cb.Detail})
+	return nil
+}
+
+func (s *StatusStore) Get(messageID string) (Receipt, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	record, ok := s.messages[messageID]
+	if !ok {
+		return Receipt{}, fmt.Errorf("%w: %s", ErrUnknownMessage, messageID)
+	}
+	return record.receipt, nil
+}
+
+func (s *StatusStore) History(messageID string) ([]StatusEvent, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	record, ok := s.messages[messageID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownMessage, messageID)
+	}
+	return append([]StatusEvent(nil), record.history...), nil
+}
+
+func containsStatus(statuses []DeliveryStatus, status DeliveryStatus) bool {
+	for _, s := range statuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestStatusStoreTransitions(t *testing.T) {
+	store := NewStatusStore()
+	receipt := newReceipt(ChannelEmail, "user@example.com")
+	if err := store.Record(receipt); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Record(receipt); err == nil {
+		t.Error("recording the same message twice succeeded")
+	}
+
+	delivered := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	if err := store.Apply(DeliveryCallback{MessageID: receipt.ID, Status: StatusDelivered, At: delivered}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Apply(DeliveryCallback{MessageID: receipt.ID, Status: StatusRead, Detail: "opened"}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := store.Get(receipt.ID)
+	if err != nil || got.Status != StatusRead {
+		t.Errorf("Get = %v, %v; want status read", got, err)
+	}
+
+	history, err := store.History(receipt.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 3 || history[0].Status != StatusSent || history[1].Status != StatusDelivered || history[2].Status != StatusRead {
+		t.Fatalf("History = %+v", history)
+	}
+	if !history[1].At.Equal(delivered) || history[2].At.IsZero() || history[2].Detail != "opened" {
+		t.Errorf("History lost callback details: %+v", history)
+	}
+	history[0].Status = StatusFailed
+	if again, _ := store.History(receipt.ID); again[0].Status != StatusSent {
+		t.Error("History returned the stored slice")
+	}
+}
+
+func TestStatusStoreRejectsTransitions(t *testing.T) {
+	store := NewStatusStore()
+	bounced := newReceipt(ChannelSMS, "+14155550100")
+	read := newReceipt(ChannelEmail, "user@example.com")
+	store.Record(bounced)
+	store.Record(read)
+	store.Apply(DeliveryCallback{MessageID: bounced.ID, Status: StatusBounced})
+	store.Apply(DeliveryCallback{MessageID: read.ID, Status: StatusDelivered})
+	store.Apply(DeliveryCallback{MessageID: read.ID, Status: StatusRead})
+
+	for _, cb := range []DeliveryCallback{
+		{MessageID: bounced.ID, Status: StatusDelivered},
+		{MessageID: read.ID, Status: StatusDelivered},
+		{MessageID: read.ID, Status: StatusSent},
+	} {
+		if err := store.Apply(cb); !errors.Is(err, ErrInvalidTransition) {
+			t.Errorf("Apply(%s to %s): got %v, want ErrInvalidTransition", cb.MessageID, cb.Status, err)
+		}
+	}
+	if history, _ := store.History(bounced.ID); len(history) != 2 {
+		t.Errorf("a rejected callback was added to the history: %+v", history)
+	}
+
+	unknown := DeliveryCallback{MessageID: "email-999999", Status: StatusDelivered}
+	if err := store.Apply(unknown); !errors.Is(err, ErrUnknownMessage) {
+		t.Errorf("Apply to an unknown message: got %v", err)
+	}
+	if _, err := store.Get(unknown.MessageID); !errors.Is(err, ErrUnknownMessage) {
+		t.Errorf("Get of an unknown message: got %v", err)
+	}
+	if _, err := store.History(unknown.MessageID); !errors.Is(err, ErrUnknownMessage) {
+		t.Errorf("History of an unknown message: got %v", err)
+	}
+}
+
+func TestFailedSendsAreRecorded(t *testing.T) {
+	store := NewStatusStore()
+	limiter := NewRateLimiter(FailFast)
+	if err := limiter.SetChannelLimit(ChannelSMS, RateLimit{Rate: 1, Burst: 1}); err != nil {
+		t.Fatal(err)
+	}
+	factory, err := NewSMSNotificationFactory("+14155550100")
+	if err != nil {
+		t.Fatal(err)
+	}
+	limited := limiter.Wrap(factory)
+	if _, err := sendAndRecord(store, limited, "first"); err != nil {
+		t.Fatal(err)
+	}
+	receipt, err := sendAndRecord(store, limited, "second")
+	if !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("got %v, want ErrRateLimited", err)
+	}
+	if receipt.Status != StatusFailed || receipt.Recipient != "+14155550100" || receipt.Channel != "SMS" {
+		t.Errorf("receipt = %v", receipt)
+	}
+	history, historyErr := store.History(receipt.ID)
+	if historyErr != nil || len(history) != 1 || history[0].Status != StatusFailed || history[0].Detail != err.Error() {
+		t.Errorf("History = %+v, %v", history, historyErr)
+	}
+	if err := store.Apply(DeliveryCallback{MessageID: receipt.ID, Status: StatusDelivered}); !errors.Is(err, ErrInvalidTransition) {
+		t.Errorf("a failed message accepted a delivery callback: %v", err)
+	}
+}
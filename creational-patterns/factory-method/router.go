@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+type SuppressionReason string
+
+const (
+	SuppressedChannelDisabled SuppressionReason = "channel not enabled"
+	SuppressedOptOut          SuppressionReason = "opted out"
+	SuppressedQuietHours      SuppressionReason = "quiet hours"
+	SuppressedMissingContact  SuppressionReason = "no contact details"
+	SuppressedInvalidContact  SuppressionReason = "invalid contact details"
+)
+
+type Suppression struct {
+	UserID  string
+	Channel string
+	Reason  SuppressionReason
+	Detail  string
+}
+
+func (s Suppression) String() string {
+	if s.Detail != "" {
+		return fmt.Sprintf("%s via %s suppressed: %s (%s)", s.UserID, s.Channel, s.Reason, s.Detail)
+	}
+	return fmt.Sprintf("%s via %s suppressed: %s", s.UserID, s.Channel, s.Reason)
+}
+
+// RouteTarget is a channel a routed message goes out on, with the factory
+// for the user's contact details on it.
+type RouteTarget struct {
+	Channel string
+	Factory NotificationFactory
+}
+
+type Route struct {
+	UserID     string
+	Targets    []RouteTarget
+	Suppressed []Suppression
+}
+
+// DispatchReport.Failed is keyed by channel name, whether the notification
+// could not be created or could not be sent.
+type DispatchReport struct {
+	UserID     string
+	Receipts   []Receipt
+	Failed     map[string]error
+	Suppressed []Suppression
+}
+
+var routedChannels = []string{ChannelEmail, ChannelSMS, ChannelPush}
+
+type NotificationRouter struct {
+	store PreferenceStore
+	now   func() time.Time
+}
+
+func NewNotificationRouter(store PreferenceStore) *NotificationRouter {
+	return &NotificationRouter{store: store, now: time.Now}
+}
+
+func (r *NotificationRouter) SetClock(now func() time.Time) {
+	r.now = now
+}
+
+func (r *NotificationRouter) Route(userID string) (Route, error) {
+	prefs, err := r.store.Get(userID)
+	if err != nil {
+		return Route{}, err
+	}
+	route := Route{UserID: userID}
+	quiet := false
+	if prefs.QuietHours != nil {
+		if quiet, err = prefs.QuietHours.Contains(r.now()); err != nil {
+			return Route{}, err
+		}
+	}
+	for _, channel := range routedChannels {
+		suppress := func(reason SuppressionReason, detail string) {
+			route.Suppressed = append(route.Suppressed, Suppression{UserID: userID, Channel: channel, Reason: reason, Detail: detail})
+		}
+		switch {
+		case prefs.OptedOut(channel):
+			suppress(SuppressedOptOut, prefs.OptOuts[channel].Source)
+			continue
+		case !prefs.Allows(channel):
+			if prefs.Contact(channel) != "" {
+				suppress(SuppressedChannelDisabled, "")
+			}
+			continue
+		case quiet:
+			suppress(SuppressedQuietHours, prefs.QuietHours.Start+"-"+prefs.QuietHours.End)
+			continue
+		}
+		factory, err := factoryFor(channel, prefs)
+		if err != nil {
+			suppress(SuppressedInvalidContact, err.Error())
+			continue
+		}
+		if factory == nil {
+			suppress(SuppressedMissingContact, "")
+			continue
+		}
+		route.Targets = append(route.Targets, RouteTarget{Channel: channel, Factory: factory})
+	}
+	return route, nil
+}
+
+func (r *NotificationRouter) Dispatch(userID, message string) (DispatchReport, error) {
+	route, err := r.Route(userID)
+	if err != nil {
+		return DispatchReport{}, err
+	}
+	return dispatchRoute(route, message), nil
+}
+
+func dispatchRoute(route Route, message string) DispatchReport {
+	report := DispatchReport{UserID: route.UserID, Failed: make(map[string]error), Suppressed: route.Suppressed}
+	for _, target := range route.Targets {
+		notification, err := target.Factory.CreateNotification()
+		if err != nil {
+			report.Failed[target.Channel] = err
+			continue
+		}
+		receipt, err := notification.Send(message)
+		if err != nil {
+			report.Failed[target.Channel] = err
+			continue
+		}
+		report.Receipts = append(report.Receipts, receipt)
+	}
+	return report
+}
+
+func factoryFor(channel string, prefs Preferences) (NotificationFactory, error) {
+	contact := prefs.Contact(channel)
+	if contact == "" {
+		return nil, nil
+	}
+	return NewNotificationFactory(channel, contact)
+}
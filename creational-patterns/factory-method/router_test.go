@@ -0,0 +1,168 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestRouteReportsEverySuppression(t *testing.T) {
+	store := NewMemoryPreferenceStore()
+	users := []Preferences{
+		{
+			UserID:   "opted-out",
+			Email:    "ann@example.com",
+			Phone:    "+14155550100",
+			Channels: []string{ChannelEmail, ChannelSMS},
+			OptOuts:  map[string]OptOut{ChannelSMS: {Source: "sms-reply:STOP"}},
+		},
+		{UserID: "disabled", Email: "ben@example.com", DeviceID: "device-ben-01", Channels: []string{ChannelEmail}},
+		{UserID: "invalid", Email: "not-an-email", Channels: []string{ChannelEmail, ChannelPush}},
+	}
+	for _, prefs := range users {
+		if err := store.Put(prefs); err != nil {
+			t.Fatal(err)
+		}
+	}
+	router := NewNotificationRouter(store)
+
+	tests := []struct {
+		userID     string
+		channels   []string
+		suppressed map[string]SuppressionReason
+	}{
+		{"opted-out", []string{ChannelEmail}, map[string]SuppressionReason{ChannelSMS: SuppressedOptOut}},
+		// SMS is neither enabled nor has a number, so there is nothing to report.
+		{"disabled", []string{ChannelEmail}, map[string]SuppressionReason{ChannelPush: SuppressedChannelDisabled}},
+		{"invalid", nil, map[string]SuppressionReason{ChannelEmail: SuppressedInvalidContact, ChannelPush: SuppressedMissingContact}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.userID, func(t *testing.T) {
+			route, err := router.Route(tt.userID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var channels []string
+			for _, target := range route.Targets {
+				channels = append(channels, target.Channel)
+			}
+			if fmt.Sprint(channels) != fmt.Sprint(tt.channels) {
+				t.Errorf("routed to %v, want %v", channels, tt.channels)
+			}
+			if len(route.Suppressed) != len(tt.suppressed) {
+				t.Fatalf("Suppressed = %v, want %v", route.Suppressed, tt.suppressed)
+			}
+			for _, s := range route.Suppressed {
+				if s.UserID != tt.userID || s.Reason != tt.suppressed[s.Channel] {
+					t.Errorf("unexpected suppression %v", s)
+				}
+			}
+		})
+	}
+
+	if _, err := router.Route("nobody"); !errors.Is(err, ErrUnknownUser) {
+		t.Errorf("Route of an unknown user: got %v", err)
+	}
+}
+
+func TestRouteHonoursQuietHours(t *testing.T) {
+	store := NewMemoryPreferenceStore()
+	if err := store.Put(Preferences{
+		UserID:     "carol",
+		Email:      "carol@example.com",
+		Phone:      "+14155550100",
+		Channels:   []string{ChannelEmail, ChannelSMS},
+		QuietHours: &QuietHours{Start: "22:00", End: "07:00", Timezone: "America/New_York"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	router := NewNotificationRouter(store)
+
+	tests := []struct {
+		utc   string
+		quiet bool
+	}{
+		{"2024-03-01T02:59:00Z", false}, // 21:59 in New York
+		{"2024-03-01T03:00:00Z", true},  // 22:00
+		{"2024-03-01T08:00:00Z", true},  // 03:00, past midnight
+		{"2024-03-01T11:59:00Z", true},  // 06:59
+		{"2024-03-01T12:00:00Z", false}, // 07:00
+		{"2024-03-01T22:00:00Z", false}, // 17:00, quiet in UTC but not locally
+	}
+	for _, tt := range tests {
+		now, err := time.Parse(time.RFC3339, tt.utc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		router.SetClock(func() time.Time { return now })
+		route, err := router.Route("carol")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tt.quiet {
+			if len(route.Targets) != 0 || len(route.Suppressed) != 2 || route.Suppressed[0].Reason != SuppressedQuietHours {
+				t.Errorf("%s: want both channels suppressed for quiet hours, got %+v", tt.utc, route)
+			} else if route.Suppressed[0].Detail != "22:00-07:00" {
+				t.Errorf("%s: detail = %q", tt.utc, route.Suppressed[0].Detail)
+			}
+		} else if len(route.Targets) != 2 || len(route.Suppressed) != 0 {
+			t.Errorf("%s: want both channels routed, got %+v", tt.utc, route)
+		}
+	}
+
+	for _, bad := range []QuietHours{{Start: "10pm", End: "07:00"}, {Start: "22:00", End: "07:00", Timezone: "Mars/Olympus"}} {
+		bad := bad
+		if err := store.Update("carol", func(prefs *Preferences) error {
+			prefs.QuietHours = &bad
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := router.Route("carol"); err == nil {
+			t.Errorf("quiet hours %+v: Route succeeded", bad)
+		}
+	}
+}
+
+type failingFactory struct{ err error }
+
+func (f failingFactory) CreateNotification() (Notification, error) {
+	return nil, f.err
+}
+
+type failingNotification struct{ Notification }
+
+func (failingNotification) Send(string) (Receipt, error) {
+	return Receipt{}, errors.New("provider unavailable")
+}
+
+type failingSendFactory struct{ NotificationFactory }
+
+func (f failingSendFactory) CreateNotification() (Notification, error) {
+	notification, err := f.NotificationFactory.CreateNotification()
+	return failingNotification{notification}, err
+}
+
+func TestDispatchKeysFailuresByChannel(t *testing.T) {
+	email, err := NewEmailNotificationFactory("dave@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	push, err := NewPushNotificationFactory("device-dave-01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := dispatchRoute(Route{UserID: "dave", Targets: []RouteTarget{
+		{Channel: ChannelEmail, Factory: email},
+		{Channel: ChannelSMS, Factory: failingFactory{errors.New("no SMS provider")}},
+		{Channel: ChannelPush, Factory: failingSendFactory{push}},
+	}}, "hello")
+
+	if len(report.Receipts) != 1 || report.Receipts[0].Channel != ChannelEmail {
+		t.Errorf("Receipts = %v", report.Receipts)
+	}
+	if len(report.Failed) != 2 || report.Failed[ChannelSMS] == nil || report.Failed[ChannelPush] == nil {
+		t.Errorf("Failed = %v, want SMS and Push", report.Failed)
+	}
+}
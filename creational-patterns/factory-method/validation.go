@@ -0,0 +1,40 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"regexp"
+)
+
+var ErrInvalidRecipient = errors.New("invalid recipient")
+
+var (
+	e164Pattern     = regexp.MustCompile(`^\+[1-9][0-9]{1,14}$`)
+	deviceIDPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9:_\-]{5,254}$`)
+)
+
+func ValidateEmail(address string) error {
+	parsed, err := mail.ParseAddress(address)
+	if err != nil {
+		return fmt.Errorf("%w: email %q: %v", ErrInvalidRecipient, address, err)
+	}
+	if parsed.Name != "" || parsed.Address != address {
+		return fmt.Errorf("%w: email %q: expected a bare addr-spec", ErrInvalidRecipient, address)
+	}
+	return nil
+}
+
+func ValidatePhoneNumber(number string) error {
+	if !e164Pattern.MatchString(number) {
+		return fmt.Errorf("%w: phone number %q is not in E.164 format", ErrInvalidRecipient, number)
+	}
+	return nil
+}
+
+func ValidateDeviceID(deviceID string) error {
+	if !deviceIDPattern.MatchString(deviceID) {
+		return fmt.Errorf("%w: device ID %q must be 6-255 characters of letters, digits, ':', '_' or '-'", ErrInvalidRecipient, deviceID)
+	}
+	return nil
+}
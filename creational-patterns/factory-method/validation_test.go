@@ -0,0 +1,105 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestValidateEmail(t *testing.T) {
+	tests := []struct {
+		address string
+		valid   bool
+	}{
+		{"user@example.com", true},
+		{"first.last+tag@sub.example.co.uk", true},
+		{"", false},
+		{"not-an-email", false},
+		{"@example.com", false},
+		{"user@", false},
+		{"Jane Doe <jane@example.com>", false},
+		{" user@example.com", false},
+		{"user@example.com\n", false},
+	}
+	for _, tt := range tests {
+		err := ValidateEmail(tt.address)
+		if (err == nil) != tt.valid {
+			t.Errorf("ValidateEmail(%q) = %v, want valid=%v", tt.address, err, tt.valid)
+		}
+		if err != nil && !errors.Is(err, ErrInvalidRecipient) {
+			t.Errorf("ValidateEmail(%q) error %v does not wrap ErrInvalidRecipient", tt.address, err)
+		}
+	}
+}
+
+func TestValidatePhoneNumber(t *testing.T) {
+	tests := []struct {
+		number string
+		valid  bool
+	}{
+		{"+14155550100", true},
+		{"+442071838750", true},
+		{"+12", true},
+		{"+123456789012345", true},
+		{"+1234567890123456", false},
+		{"14155550100", false},
+		{"+04155550100", false},
+		{"+1 415 555 0100", false},
+		{"555-0100", false},
+		{"+", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		err := ValidatePhoneNumber(tt.number)
+		if (err == nil) != tt.valid {
+			t.Errorf("ValidatePhoneNumber(%q) = %v, want valid=%v", tt.number, err, tt.valid)
+		}
+		if err != nil && !errors.Is(err, ErrInvalidRecipient) {
+			t.Errorf("ValidatePhoneNumber(%q) error %v does not wrap ErrInvalidRecipient", tt.number, err)
+		}
+	}
+}
+
+func TestValidateDeviceID(t *testing.T) {
+	tests := []struct {
+		deviceID string
+		valid    bool
+	}{
+		{"device-abc-123", true},
+		{"abc123", true},
+		{"fcm:token_ABC-123", true},
+		{strings.Repeat("a", 255), true},
+		{strings.Repeat("a", 256), false},
+		{"abc", false},
+		{"abc12", false},
+		{"-abc123", false},
+		{"device abc", false},
+		{"device/abc", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		err := ValidateDeviceID(tt.deviceID)
+		if (err == nil) != tt.valid {
+			t.Errorf("ValidateDeviceID(%q) = %v, want valid=%v", tt.deviceID, err, tt.valid)
+		}
+		if err != nil && !errors.Is(err, ErrInvalidRecipient) {
+			t.Errorf("ValidateDeviceID(%q) error %v does not wrap ErrInvalidRecipient", tt.deviceID, err)
+		}
+	}
+}
+
+func TestFactoriesRejectInvalidRecipients(t *testing.T) {
+	if _, err := NewEmailNotificationFactory("not-an-email"); !errors.Is(err, ErrInvalidRecipient) {
+		t.Errorf("NewEmailNotificationFactory: got %v, want ErrInvalidRecipient", err)
+	}
+	if _, err := NewSMSNotificationFactory("555-0100"); !errors.Is(err, ErrInvalidRecipient) {
+		t.Errorf("NewSMSNotificationFactory: got %v, want ErrInvalidRecipient", err)
+	}
+	if _, err := NewPushNotificationFactory("abc"); !errors.Is(err, ErrInvalidRecipient) {
+		t.Errorf("NewPushNotificationFactory: got %v, want ErrInvalidRecipient", err)
+	}
+	unchecked := &SMSNotificationFactory{phoneNumber: "12345"}
+	if _, err := unchecked.CreateNotification(); !errors.Is(err, ErrInvalidRecipient) {
+		t.Errorf("CreateNotification on an unvalidated factory: got %v, want ErrInvalidRecipient", err)
+	}
+}
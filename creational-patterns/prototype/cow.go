@@ -0,0 +1,190 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"sync/atomic"
+)
+
+type CloneMode int
+
+const (
+	EagerClone CloneMode = iota
+	CopyOnWriteClone
+)
+
+// cowState tracks storage shared between copy-on-write clones. Every
+// document sharing the storage holds the same counter, which counts those
+// documents; a document that copies the storage for itself releases its
+// share, so the last one left writes in place instead of copying again. The
+// counter is atomic because a registry may hand out shared clones of one
+// prototype from many goroutines at once.
+//
+// A document that is dropped without ever writing keeps its share, so the
+// others still copy once on their next write.
+type cowState struct {
+	refs atomic.Pointer[atomic.Int32]
+}
+
+// share makes clone a sharer of the storage s guards.
+func (s *cowState) share(clone *cowState) {
+	refs := s.refs.Load()
+	if refs == nil {
+		fresh := new(atomic.Int32)
+		fresh.Store(1)
+		if s.refs.CompareAndSwap(nil, fresh) {
+			refs = fresh
+		} else {
+			refs = s.refs.Load()
+		}
+	}
+	refs.Add(1)
+	clone.refs.Store(refs)
+}
+
+func (s *cowState) shared() bool {
+	refs := s.refs.Load()
+	return refs != nil && refs.Load() > 1
+}
+
+// release gives up this document's share once it no longer uses the
+// shared storage.
+func (s *cowState) release() {
+	if refs := s.refs.Swap(nil); refs != nil {
+		refs.Add(-1)
+	}
+}
+
+type sharedCloner interface {
+	CloneShared() (Document, error)
+}
+
+// CloneShared returns a clone whose experience and skills share storage
+// with r until either side changes them through AddExperience, AddSkill,
+// SetExperienceAt, SetSkillAt, SetExperience or SetSkills.
+func (r *Resume) CloneShared() (Document, error) {
+	clone := &Resume{
+		BaseDocument: DeepCopy(r.BaseDocument),
+		experience:   r.experience,
+		skills:       r.skills,
+		Education:    r.Education,
+	}
+	clone.markCloned(&r.BaseDocument)
+	r.lists.share(&clone.lists)
+	return clone, nil
+}
+
+func (r *Resume) ensureListsOwned() {
+	if r.lists.shared() {
+		r.experience = DeepCopy(r.experience)
+		r.skills = DeepCopy(r.skills)
+	}
+	r.lists.release()
+}
+
+// Experience and Skills return copies; use the Add and Set methods to
+// change them.
+func (r *Resume) Experience() []string {
+	return DeepCopy(r.experience)
+}
+
+func (r *Resume) Skills() []string {
+	return DeepCopy(r.skills)
+}
+
+func (r *Resume) AddExperience(entry string) {
+	r.ensureListsOwned()
+	r.experience = append(r.experience, entry)
+}
+
+func (r *Resume) AddSkill(skill string) {
+	r.ensureListsOwned()
+	r.skills = append(r.skills, skill)
+}
+
+func (r *Resume) SetExperienceAt(i int, entry string) {
+	r.ensureListsOwned()
+	r.experience[i] = entry
+}
+
+func (r *Resume) SetSkillAt(i int, skill string) {
+	r.ensureListsOwned()
+	r.skills[i] = skill
+}
+
+func (r *Resume) SetExperience(entries []string) {
+	r.lists.release()
+	r.experience = DeepCopy(entries)
+}
+
+func (r *Resume) SetSkills(skills []string) {
+	r.lists.release()
+	r.skills = DeepCopy(skills)
+}
+
+func (r *Resume) SharesLists() bool {
+	return r.lists.shared()
+}
+
+// MarshalJSON and UnmarshalJSON keep the unexported lists under
+// "Experience" and "Skills".
+func (r *Resume) MarshalJSON() ([]byte, error) {
+	type plain Resume
+	return json.Marshal(struct {
+		*plain
+		Experience []string
+		Skills     []string
+	}{(*plain)(r), r.experience, r.skills})
+}
+
+func (r *Resume) UnmarshalJSON(b []byte) error {
+	type plain Resume
+	aux := struct {
+		*plain
+		Experience []string
+		Skills     []string
+	}{plain: (*plain)(r)}
+	if err := json.Unmarshal(b, &aux); err != nil {
+		return err
+	}
+	r.lists.release()
+	r.experience, r.skills = aux.Experience, aux.Skills
+	return nil
+}
+
+// CloneShared returns a clone whose data map is shared with r until either
+// side writes to it through SetData, DeleteData or ReplaceData. The clone is
+// normalised to the schema like Clone, and the error says why it does not
+// fit.
+func (r *Report) CloneShared() (Document, error) {
+	clone := &Report{
+		BaseDocument: DeepCopy(r.BaseDocument),
+		ReportType:   r.ReportType,
+		Department:   r.Department,
+		Quarter:      r.Quarter,
+		Data:         r.Data,
+	}
+	clone.markCloned(&r.BaseDocument)
+	r.dataState.share(&clone.dataState)
+	return clone, clone.normalizeData()
+}
+
+func (r *Report) ensureDataOwned() {
+	if r.dataState.shared() {
+		r.Data = DeepCopy(r.Data)
+	}
+	r.dataState.release()
+}
+
+func (r *Report) DeleteData(key string) {
+	r.ensureDataOwned()
+	delete(r.Data, key)
+}
+
+func (r *Report) SharesData() bool {
+	return r.dataState.shared()
+}
+
+func sameType(a, b interface{}) bool {
+	return reflect.TypeOf(a) == reflect.TypeOf(b)
+}
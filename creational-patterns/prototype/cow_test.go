@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func newBigReport(entries int) *Report {
+	data := make(map[string]interface{}, entries)
+	for i := 0; i < entries; i++ {
+		data[fmt.Sprintf("metric-%05d", i)] = map[string]interface{}{"value": i, "history": []interface{}{i, i + 1}}
+	}
+	report := &Report{ReportType: "untyped"}
+	if err := report.ReplaceData(data); err != nil {
+		panic(err)
+	}
+	return report
+}
+
+func newBigResume(entries int) *Resume {
+	resume := &Resume{}
+	experience := make([]string, entries)
+	for i := range experience {
+		experience[i] = fmt.Sprintf("Company %d - %d years", i, i%10)
+	}
+	resume.SetExperience(experience)
+	resume.SetSkills([]string{"Go", "SQL"})
+	return resume
+}
+
+func TestCopyOnWriteReportIsolation(t *testing.T) {
+	template := newBigReport(3)
+	doc, err := template.CloneShared()
+	if err != nil {
+		t.Fatal(err)
+	}
+	clone := doc.(*Report)
+	if !clone.SharesData() || !template.SharesData() {
+		t.Fatal("a fresh copy-on-write clone should share its template's data")
+	}
+
+	// Neither the getters nor writes on one side may reach the other.
+	value, _ := clone.Value("metric-00000")
+	value.(map[string]interface{})["leaked"] = true
+	if v, _ := template.Value("metric-00000"); v.(map[string]interface{})["leaked"] != nil {
+		t.Fatal("writing to a value from Value changed the template")
+	}
+	clone.SetData("metric-00001", 42)
+	clone.DeleteData("metric-00002")
+	if v, _ := template.Value("metric-00001"); v == 42 {
+		t.Error("SetData on the clone changed the template")
+	}
+	if _, ok := template.Value("metric-00002"); !ok {
+		t.Error("DeleteData on the clone changed the template")
+	}
+
+	// The clone released its share, so the template owns its map again.
+	if clone.SharesData() || template.SharesData() {
+		t.Errorf("after the clone's write: clone shares %v, template shares %v, want false for both",
+			clone.SharesData(), template.SharesData())
+	}
+}
+
+func TestCopyOnWriteResumeIsolation(t *testing.T) {
+	template := newBigResume(3)
+	doc, _ := template.CloneShared()
+	clone := doc.(*Resume)
+	other, _ := template.CloneShared()
+
+	clone.Skills()[0] = "leaked"
+	clone.SetSkillAt(1, "Rust")
+	clone.AddExperience("Company Z - 1 year")
+	template.SetExperienceAt(0, "Company A - 9 years")
+
+	if got := template.Skills(); got[0] != "Go" || got[1] != "SQL" {
+		t.Errorf("template skills = %v, want [Go SQL]", got)
+	}
+	if got := clone.Experience(); len(got) != 4 || got[0] != "Company 0 - 0 years" {
+		t.Errorf("clone experience = %v", got)
+	}
+	if got := other.(*Resume).Experience(); len(got) != 3 || got[0] != "Company 0 - 0 years" {
+		t.Errorf("untouched clone experience = %v", got)
+	}
+	// Both other sharers copied on write, so the untouched clone is the
+	// last holder of the original lists.
+	if other.(*Resume).SharesLists() {
+		t.Error("the last holder of the shared lists still reports them as shared")
+	}
+}
+
+func TestCopyOnWriteConcurrentClones(t *testing.T) {
+	template := newBigReport(10)
+	var wg sync.WaitGroup
+	for i := 0; i < 32; i++ {
+		i := i
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			doc, err := template.CloneShared()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			report := doc.(*Report)
+			report.SetData("metric-00000", i)
+			if v, _ := report.Value("metric-00000"); v != i {
+				t.Errorf("clone %d sees %v", i, v)
+			}
+		}()
+	}
+	wg.Wait()
+	if v, _ := template.Value("metric-00000"); v == nil {
+		t.Fatal("template lost its data")
+	} else if m, ok := v.(map[string]interface{}); !ok || m["value"] != 0 {
+		t.Errorf("template value changed to %v", v)
+	}
+}
+
+func BenchmarkCloneReport(b *testing.B) {
+	template := newBigReport(1000)
+	b.Run("eager", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			template.Clone()
+		}
+	})
+	b.Run("copy-on-write", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			template.CloneShared()
+		}
+	})
+	b.Run("copy-on-write+write", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			doc, _ := template.CloneShared()
+			doc.(*Report).SetData("metric-00000", i)
+		}
+	})
+}
+
+func BenchmarkCloneResume(b *testing.B) {
+	template := newBigResume(1000)
+	b.Run("eager", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			template.Clone()
+		}
+	})
+	b.Run("copy-on-write", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			template.CloneShared()
+		}
+	})
+	b.Run("copy-on-write+write", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			doc, _ := template.CloneShared()
+			doc.(*Resume).AddSkill("Rust")
+		}
+	})
+}
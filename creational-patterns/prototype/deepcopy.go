@@ -0,0 +1,188 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"unsafe"
+)
+
+// DeepCopy returns a copy of src that shares no mutable memory with it.
+// Unexported fields of this package's types are deep copied too; those of
+// other packages' types are copied by assignment, so their internals are
+// only as independent as the package makes them. Struct fields can opt out
+// with a `clone:"-"` tag (left as the zero value) or `clone:"shallow"`
+// (copied by assignment).
+//
+// sync/atomic values are read with Load and their contents deep copied.
+// Other sync types such as Mutex are reset to their zero value, so a clone
+// never starts out holding a lock. Funcs and channels are copied by
+// assignment and stay shared.
+func DeepCopy[T any](src T) T {
+	c := &copier{
+		pointers: make(map[visitKey]reflect.Value),
+		maps:     make(map[visitKey]reflect.Value),
+		slices:   make(map[sliceKey]reflect.Value),
+	}
+	in := reflect.ValueOf(&src).Elem()
+	out := reflect.New(in.Type()).Elem()
+	c.copyInto(out, in)
+	return out.Interface().(T)
+}
+
+var localPkgPath = reflect.TypeOf(copier{}).PkgPath()
+
+type visitKey struct {
+	ptr uintptr
+	typ reflect.Type
+}
+
+type sliceKey struct {
+	visitKey
+	len int
+}
+
+type copier struct {
+	pointers map[visitKey]reflect.Value
+	maps     map[visitKey]reflect.Value
+	slices   map[sliceKey]reflect.Value
+}
+
+func (c *copier) copyInto(dst, src reflect.Value) {
+	switch src.Kind() {
+	case reflect.Pointer:
+		if src.IsNil() {
+			return
+		}
+		key := visitKey{src.Pointer(), src.Type()}
+		if seen, ok := c.pointers[key]; ok {
+			dst.Set(seen)
+			return
+		}
+		ptr := reflect.New(src.Type().Elem())
+		c.pointers[key] = ptr
+		c.copyInto(ptr.Elem(), src.Elem())
+		dst.Set(ptr)
+
+	case reflect.Interface:
+		if src.IsNil() {
+			return
+		}
+		elem := src.Elem()
+		copied := reflect.New(elem.Type()).Elem()
+		c.copyInto(copied, elem)
+		dst.Set(copied)
+
+	case reflect.Map:
+		if src.IsNil() {
+			return
+		}
+		key := visitKey{src.Pointer(), src.Type()}
+		if seen, ok := c.maps[key]; ok {
+			dst.Set(seen)
+			return
+		}
+		m := reflect.MakeMapWithSize(src.Type(), src.Len())
+		c.maps[key] = m
+		iter := src.MapRange()
+		for iter.Next() {
+			k := reflect.New(src.Type().Key()).Elem()
+			c.copyInto(k, iter.Key())
+			v := reflect.New(src.Type().Elem()).Elem()
+			c.copyInto(v, iter.Value())
+			m.SetMapIndex(k, v)
+		}
+		dst.Set(m)
+
+	case reflect.Slice:
+		if src.IsNil() {
+			return
+		}
+		key := sliceKey{visitKey{src.Pointer(), src.Type()}, src.Len()}
+		if seen, ok := c.slices[key]; ok {
+			dst.Set(seen)
+			return
+		}
+		s := reflect.MakeSlice(src.Type(), src.Len(), src.Len())
+		c.slices[key] = s
+		for i := 0; i < src.Len(); i++ {
+			c.copyInto(s.Index(i), src.Index(i))
+		}
+		dst.Set(s)
+
+	case reflect.Array:
+		for i := 0; i < src.Len(); i++ {
+			c.copyInto(dst.Index(i), src.Index(i))
+		}
+
+	case reflect.Struct:
+		t := src.Type()
+		// A non-addressable src is already a private copy (a map value or
+		// the contents of an interface), so copying it again is safe.
+		src = addressable(src)
+		switch t.PkgPath() {
+		case "sync/atomic":
+			c.copyAtomic(dst, src)
+			return
+		case "sync":
+			return
+		}
+		for i := 0; i < src.NumField(); i++ {
+			field := t.Field(i)
+			from, to := exposed(src.Field(i)), exposed(dst.Field(i))
+			tag := cloneTag(field)
+			if !field.IsExported() && field.PkgPath != localPkgPath && tag != "-" {
+				// Another package's internals (time.Time's *Location, say)
+				// may depend on pointer identity, so they are left alone.
+				tag = "shallow"
+			}
+			switch tag {
+			case "-":
+			case "shallow":
+				to.Set(from)
+			default:
+				c.copyInto(to, from)
+			}
+		}
+
+	default:
+		dst.Set(src)
+	}
+}
+
+// copyAtomic copies a sync/atomic value such as atomic.Int32 or
+// atomic.Pointer[T] through its Load and Store methods.
+func (c *copier) copyAtomic(dst, src reflect.Value) {
+	load := src.Addr().MethodByName("Load")
+	if !load.IsValid() {
+		return
+	}
+	value := load.Call(nil)[0]
+	if value.Kind() == reflect.Interface && value.IsNil() {
+		return
+	}
+	copied := reflect.New(value.Type()).Elem()
+	c.copyInto(copied, value)
+	dst.Addr().MethodByName("Store").Call([]reflect.Value{copied})
+}
+
+// addressable returns v itself if it is addressable, or else an addressable
+// copy of it.
+func addressable(v reflect.Value) reflect.Value {
+	if v.CanAddr() {
+		return v
+	}
+	tmp := reflect.New(v.Type()).Elem()
+	tmp.Set(v)
+	return tmp
+}
+
+// exposed returns a settable view of an addressable struct field, including
+// unexported ones that reflection would otherwise refuse to read or set.
+func exposed(field reflect.Value) reflect.Value {
+	return reflect.NewAt(field.Type(), unsafe.Pointer(field.UnsafeAddr())).Elem()
+}
+
+func cloneTag(field reflect.StructField) string {
+	tag, _, _ := strings.Cut(field.Tag.Get("clone"), ",")
+	return tag
+}
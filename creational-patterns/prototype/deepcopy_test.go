@@ -0,0 +1,151 @@
+package main
+
+import (
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"unsafe"
+)
+
+type fuzzNode struct {
+	Name    string
+	Tags    []string
+	Attrs   map[string]interface{}
+	Next    *fuzzNode
+	counts  map[string]int
+	history []*fuzzNode
+	hits    atomic.Int64
+	last    atomic.Pointer[string]
+	mu      sync.Mutex
+}
+
+func newFuzzGraph(name string, n uint8, data []byte) *fuzzNode {
+	root := &fuzzNode{Name: name, counts: map[string]int{}, Attrs: map[string]interface{}{}}
+	node := root
+	for i := 0; i < int(n%8); i++ {
+		next := &fuzzNode{Name: name + string(rune('a'+i)), counts: map[string]int{name: i}}
+		next.Tags = append(next.Tags, string(data))
+		next.Attrs = map[string]interface{}{
+			"bytes":  append([]byte(nil), data...),
+			"nested": map[string]interface{}{"list": []interface{}{i, name, data}},
+		}
+		next.history = append(next.history, root, node)
+		next.hits.Store(int64(i))
+		label := name
+		next.last.Store(&label)
+		node.Next = next
+		node = next
+	}
+	if len(data)%2 == 1 {
+		node.Next = root // close a cycle
+	}
+	root.Attrs["self"] = root
+	return root
+}
+
+// memory collects the address of every pointer target, map and slice
+// backing array reachable from v, following unexported fields as well.
+func memory(v reflect.Value, seen map[uintptr]reflect.Kind) {
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Map:
+		if v.IsNil() {
+			return
+		}
+		if _, ok := seen[v.Pointer()]; ok {
+			return
+		}
+		seen[v.Pointer()] = v.Kind()
+		if v.Kind() == reflect.Pointer {
+			memory(v.Elem(), seen)
+			return
+		}
+		iter := v.MapRange()
+		for iter.Next() {
+			memory(iter.Key(), seen)
+			memory(iter.Value(), seen)
+		}
+	case reflect.UnsafePointer:
+		if p := v.Pointer(); p != 0 {
+			seen[p] = v.Kind()
+		}
+	case reflect.Slice:
+		if v.Cap() == 0 {
+			return
+		}
+		if _, ok := seen[v.Pointer()]; ok {
+			return
+		}
+		seen[v.Pointer()] = v.Kind()
+		for i := 0; i < v.Len(); i++ {
+			memory(v.Index(i), seen)
+		}
+	case reflect.Interface:
+		if !v.IsNil() {
+			memory(v.Elem(), seen)
+		}
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			memory(v.Index(i), seen)
+		}
+	case reflect.Struct:
+		if !v.CanAddr() {
+			tmp := reflect.New(v.Type()).Elem()
+			tmp.Set(v)
+			v = tmp
+		}
+		for i := 0; i < v.NumField(); i++ {
+			f := v.Field(i)
+			memory(reflect.NewAt(f.Type(), unsafe.Pointer(f.UnsafeAddr())).Elem(), seen)
+		}
+	}
+}
+
+func assertNoSharedMemory(t *testing.T, original, clone interface{}) {
+	t.Helper()
+	a, b := map[uintptr]reflect.Kind{}, map[uintptr]reflect.Kind{}
+	memory(reflect.ValueOf(original), a)
+	memory(reflect.ValueOf(clone), b)
+	for addr, kind := range b {
+		if _, ok := a[addr]; ok {
+			t.Fatalf("clone shares a %s at %#x with the original", kind, addr)
+		}
+	}
+}
+
+func FuzzDeepCopy(f *testing.F) {
+	f.Add("root", uint8(3), []byte("payload"))
+	f.Add("", uint8(0), []byte{})
+	f.Add("cycle", uint8(7), []byte("odd"))
+	f.Fuzz(func(t *testing.T, name string, n uint8, data []byte) {
+		original := newFuzzGraph(name, n, data)
+		original.mu.Lock()
+		defer original.mu.Unlock()
+
+		clone := DeepCopy(original)
+		assertNoSharedMemory(t, original, clone)
+		if !clone.mu.TryLock() {
+			t.Fatal("clone inherited the original's locked mutex")
+		}
+		for a, b := original, clone; a != nil; a, b = a.Next, b.Next {
+			if a.Name != b.Name || a.hits.Load() != b.hits.Load() || !reflect.DeepEqual(a.counts, b.counts) {
+				t.Fatalf("clone of %q differs from the original", a.Name)
+			}
+			if (a.last.Load() == nil) != (b.last.Load() == nil) || (a.last.Load() != nil && *a.last.Load() != *b.last.Load()) {
+				t.Fatalf("atomic pointer of %q was not copied", a.Name)
+			}
+			if a.Next == original {
+				if b.Next != clone {
+					t.Fatal("cycle back to the root was not preserved")
+				}
+				break
+			}
+		}
+
+		report := &Report{ReportType: name, Data: map[string]interface{}{
+			"raw":    data,
+			"nested": map[string]interface{}{"n": int(n), "list": []interface{}{name}},
+		}}
+		assertNoSharedMemory(t, report, DeepCopy(report))
+	})
+}
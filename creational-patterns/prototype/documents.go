@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+type LineItem struct {
+	Description string
+	Quantity    int
+	UnitPrice   float64
+}
+
+func (li LineItem) Amount() float64 {
+	return float64(li.Quantity) * li.UnitPrice
+}
+
+type Invoice struct {
+	BaseDocument
+	Number   string
+	Customer string
+	Currency string
+	IssuedAt time.Time
+	DueAt    time.Time
+	Items    []LineItem
+}
+
+func (i *Invoice) Clone() Document {
+	clone := DeepCopy(i)
+	clone.markCloned(&i.BaseDocument)
+	return clone
+}
+
+func (i *Invoice) Total() float64 {
+	var total float64
+	for _, item := range i.Items {
+		total += item.Amount()
+	}
+	return total
+}
+
+func (i *Invoice) GetInfo() string {
+	var info []string
+	info = append(info, "=== INVOICE ===")
+	info = append(info, fmt.Sprintf("Title: %s", i.Title))
+	info = append(info, fmt.Sprintf("Number: %s", i.Number))
+	info = append(info, fmt.Sprintf("Customer: %s", i.Customer))
+	info = append(info, fmt.Sprintf("Items: %d", len(i.Items)))
+	info = append(info, fmt.Sprintf("Total: %.2f %s", i.Total(), i.Currency))
+	info = append(info, fmt.Sprintf("Due: %s", i.DueAt.Format("2006-01-02")))
+	info = append(info, fmt.Sprintf("Version: %d", i.Version))
+	info = append(info, fmt.Sprintf("Created: %s", i.CreatedAt.Format("2006-01-02")))
+	info = append(info, fmt.Sprintf("Modified: %s", i.ModifiedAt.Format("2006-01-02")))
+	return strings.Join(info, "\n")
+}
+
+func (i *Invoice) SetTitle(title string) {
+	i.Title = title
+}
+
+func (i *Invoice) SetContent(content string) {
+	i.Content = content
+}
+
+func (i *Invoice) exportView() documentView {
+	view := baseView("Invoice", &i.BaseDocument)
+	view.Fields = append(view.Fields,
+		viewField{"Number", i.Number},
+		viewField{"Customer", i.Customer},
+		viewField{"Issued", i.IssuedAt.Format("2006-01-02")},
+		viewField{"Due", i.DueAt.Format("2006-01-02")},
+		viewField{"Total", fmt.Sprintf("%.2f %s", i.Total(), i.Currency)},
+	)
+	table := viewTable{Title: "Items", Header: []string{"Description", "Quantity", "Unit Price", "Amount"}}
+	for _, item := range i.Items {
+		table.Rows = append(table.Rows, []string{
+			item.Description,
+			fmt.Sprint(item.Quantity),
+			fmt.Sprintf("%.2f", item.UnitPrice),
+			fmt.Sprintf("%.2f", item.Amount()),
+		})
+	}
+	view.Tables = append(view.Tables, table)
+	return view
+}
+
+type Contract struct {
+	BaseDocument
+	Parties       []string
+	EffectiveDate time.Time
+	ExpiresAt     time.Time
+	Clauses       []string
+}
+
+func (c *Contract) Clone() Document {
+	clone := DeepCopy(c)
+	clone.markCloned(&c.BaseDocument)
+	return clone
+}
+
+func (c *Contract) GetInfo() string {
+	var info []string
+	info = append(info, "=== CONTRACT ===")
+	info = append(info, fmt.Sprintf("Title: %s", c.Title))
+	info = append(info, fmt.Sprintf("Parties: %s", strings.Join(c.Parties, ", ")))
+	info = append(info, fmt.Sprintf("Effective: %s", c.EffectiveDate.Format("2006-01-02")))
+	info = append(info, fmt.Sprintf("Expires: %s", c.ExpiresAt.Format("2006-01-02")))
+	info = append(info, fmt.Sprintf("Clauses: %d", len(c.Clauses)))
+	info = append(info, fmt.Sprintf("Version: %d", c.Version))
+	info = append(info, fmt.Sprintf("Created: %s", c.CreatedAt.Format("2006-01-02")))
+	info = append(info, fmt.Sprintf("Modified: %s", c.ModifiedAt.Format("2006-01-02")))
+	return strings.Join(info, "\n")
+}
+
+func (c *Contract) SetTitle(title string) {
+	c.Title = title
+}
+
+func (c *Contract) SetContent(content string) {
+	c.Content = content
+}
+
+func (c *Contract) exportView() documentView {
+	view := baseView("Contract", &c.BaseDocument)
+	view.Fields = append(view.Fields,
+		viewField{"Effective", c.EffectiveDate.Format("2006-01-02")},
+		viewField{"Expires", c.ExpiresAt.Format("2006-01-02")},
+	)
+	view.Lists = append(view.Lists,
+		viewList{"Parties", c.Parties},
+		viewList{"Clauses", c.Clauses},
+	)
+	return view
+}
+
+type Letter struct {
+	BaseDocument
+	Recipient  string
+	Salutation string
+	Closing    string
+}
+
+func (l *Letter) Clone() Document {
+	clone := DeepCopy(l)
+	clone.markCloned(&l.BaseDocument)
+	return clone
+}
+
+func (l *Letter) GetInfo() string {
+	var info []string
+	info = append(info, "=== LETTER ===")
+	info = append(info, fmt.Sprintf("Title: %s", l.Title))
+	info = append(info, fmt.Sprintf("To: %s", l.Recipient))
+	if l.Author != nil {
+		info = append(info, fmt.Sprintf("From: %s (%s)", l.Author.Name, l.Author.Email))
+	}
+	info = append(info, fmt.Sprintf("Version: %d", l.Version))
+	info = append(info, fmt.Sprintf("Created: %s", l.CreatedAt.Format("2006-01-02")))
+	info = append(info, fmt.Sprintf("Modified: %s", l.ModifiedAt.Format("2006-01-02")))
+	return strings.Join(info, "\n")
+}
+
+func (l *Letter) SetTitle(title string) {
+	l.Title = title
+}
+
+func (l *Letter) SetContent(content string) {
+	l.Content = content
+}
+
+func (l *Letter) exportView() documentView {
+	view := baseView("Letter", &l.BaseDocument)
+	view.Fields = append(view.Fields, viewField{"Recipient", l.Recipient})
+	view.Content = strings.TrimSpace(strings.Join([]string{l.Salutation, l.Content, l.Closing}, "\n\n"))
+	return view
+}
@@ -0,0 +1,468 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var ErrUnknownFormat = errors.New("unknown export format")
+
+type Exporter interface {
+	Export(w io.Writer, doc Document) error
+}
+
+type ExporterFunc func(w io.Writer, doc Document) error
+
+func (f ExporterFunc) Export(w io.Writer, doc Document) error {
+	return f(w, doc)
+}
+
+var (
+	exportersMu sync.RWMutex
+	exporters   = map[string]Exporter{
+		"markdown": ExporterFunc(exportMarkdown),
+		"html":     ExporterFunc(exportHTML),
+		"pdf":      ExporterFunc(exportPDF),
+	}
+)
+
+func RegisterExporter(format string, exporter Exporter) {
+	exportersMu.Lock()
+	defer exportersMu.Unlock()
+	exporters[strings.ToLower(format)] = exporter
+}
+
+func ExportFormats() []string {
+	exportersMu.RLock()
+	defer exportersMu.RUnlock()
+	formats := make([]string, 0, len(exporters))
+	for format := range exporters {
+		formats = append(formats, format)
+	}
+	sort.Strings(formats)
+	return formats
+}
+
+func Export(format string, w io.Writer, doc Document) error {
+	exportersMu.RLock()
+	exporter, ok := exporters[strings.ToLower(format)]
+	exportersMu.RUnlock()
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownFormat, format)
+	}
+	return exporter.Export(w, doc)
+}
+
+type viewField struct {
+	Label string
+	Value string
+}
+
+type viewList struct {
+	Title string
+	Items []string
+}
+
+type viewTable struct {
+	Title  string
+	Header []string
+	Rows   [][]string
+}
+
+type documentView struct {
+	Kind    string
+	Title   string
+	Fields  []viewField
+	Content string
+	Lists   []viewList
+	Tables  []viewTable
+}
+
+type exportViewer interface {
+	exportView() documentView
+}
+
+func viewOf(doc Document) (documentView, error) {
+	if v, ok := doc.(exportViewer); ok {
+		return v.exportView(), nil
+	}
+	switch d := doc.(type) {
+	case *Resume:
+		view := baseView("Resume", &d.BaseDocument)
+		view.Fields = append(view.Fields, viewField{"Education", d.Education})
+		if d.Author != nil && d.Author.Address != nil {
+			view.Fields = append(view.Fields, viewField{"Location", d.Author.Address.City + ", " + d.Author.Address.Country})
+		}
+		view.Lists = append(view.Lists,
+			viewList{"Experience", d.experience},
+			viewList{"Skills", d.skills},
+		)
+		return view, nil
+	case *Report:
+		view := baseView("Report", &d.BaseDocument)
+		view.Fields = append(view.Fields,
+			viewField{"Type", d.ReportType},
+			viewField{"Department", d.Department},
+			viewField{"Quarter", d.Quarter},
+		)
+		table := viewTable{Title: "Data", Header: []string{"Key", "Value"}}
+		for _, k := range d.Keys() {
+			table.Rows = append(table.Rows, []string{k, fmt.Sprint(d.Data[k])})
+		}
+		view.Tables = append(view.Tables, table)
+		return view, nil
+	}
+	return documentView{}, fmt.Errorf("export: unsupported document type %T", doc)
+}
+
+func baseView(kind string, b *BaseDocument) documentView {
+	view := documentView{Kind: kind, Title: b.Title, Content: b.Content}
+	if b.Author != nil {
+		view.Fields = append(view.Fields, viewField{"Author", fmt.Sprintf("%s (%s)", b.Author.Name, b.Author.Email)})
+	}
+	view.Fields = append(view.Fields,
+		viewField{"Version", fmt.Sprint(b.Version)},
+		viewField{"Created", b.CreatedAt.Format("2006-01-02")},
+		viewField{"Modified", b.ModifiedAt.Format("2006-01-02")},
+	)
+	return view
+}
+
+func exportMarkdown(w io.Writer, doc Document) error {
+	view, err := viewOf(doc)
+	if err != nil {
+		return err
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n", markdownEscape(view.Title))
+	fmt.Fprintf(&b, "_%s_\n\n", markdownEscape(view.Kind))
+	for _, f := range view.Fields {
+		fmt.Fprintf(&b, "- **%s:** %s\n", markdownEscape(f.Label), markdownEscape(f.Value))
+	}
+	if view.Content != "" {
+		for _, paragraph := range strings.Split(strings.ReplaceAll(view.Content, "\r\n", "\n"), "\n") {
+			if paragraph = strings.TrimSpace(paragraph); paragraph != "" {
+				fmt.Fprintf(&b, "\n%s\n", markdownEscape(paragraph))
+			}
+		}
+	}
+	for _, list := range view.Lists {
+		fmt.Fprintf(&b, "\n## %s\n\n", markdownEscape(list.Title))
+		for _, item := range list.Items {
+			fmt.Fprintf(&b, "- %s\n", markdownEscape(item))
+		}
+	}
+	for _, table := range view.Tables {
+		fmt.Fprintf(&b, "\n## %s\n\n", markdownEscape(table.Title))
+		fmt.Fprintf(&b, "| %s |\n", strings.Join(markdownEscapeAll(table.Header), " | "))
+		fmt.Fprintf(&b, "|%s\n", strings.Repeat("---|", len(table.Header)))
+		for _, row := range table.Rows {
+			fmt.Fprintf(&b, "| %s |\n", strings.Join(markdownEscapeAll(row), " | "))
+		}
+	}
+	_, err = io.WriteString(w, b.String())
+	return err
+}
+
+// markdownEscaper backslash-escapes the characters that would otherwise
+// start emphasis or code, or end a table cell, and turns line breaks into
+// <br> so a multi-line value stays inside its list item or table cell.
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	"`", "\\`",
+	"*", `\*`,
+	"_", `\_`,
+	"|", `\|`,
+	"\r\n", "<br>",
+	"\n", "<br>",
+	"\r", "<br>",
+)
+
+func markdownEscape(s string) string {
+	return markdownEscaper.Replace(s)
+}
+
+func markdownEscapeAll(cells []string) []string {
+	escaped := make([]string, len(cells))
+	for i, cell := range cells {
+		escaped[i] = markdownEscape(cell)
+	}
+	return escaped
+}
+
+var htmlTemplate = template.Must(template.New("document").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p><em>{{.Kind}}</em></p>
+<dl>
+{{- range .Fields}}
+<dt>{{.Label}}</dt><dd>{{.Value}}</dd>
+{{- end}}
+</dl>
+{{- if .Content}}
+<p>{{.Content}}</p>
+{{- end}}
+{{- range .Lists}}
+<h2>{{.Title}}</h2>
+<ul>
+{{- range .Items}}
+<li>{{.}}</li>
+{{- end}}
+</ul>
+{{- end}}
+{{- range .Tables}}
+<h2>{{.Title}}</h2>
+<table>
+<tr>{{range .Header}}<th>{{.}}</th>{{end}}</tr>
+{{- range .Rows}}
+<tr>{{range .}}<td>{{.}}</td>{{end}}</tr>
+{{- end}}
+</table>
+{{- end}}
+</body>
+</html>
+`))
+
+func exportHTML(w io.Writer, doc Document) error {
+	view, err := viewOf(doc)
+	if err != nil {
+		return err
+	}
+	return htmlTemplate.Execute(w, view)
+}
+
+const (
+	pdfLinesPerPage = 50
+	pdfWrapColumn   = 90
+
+	pdfMaxColumnWidth = 30
+)
+
+func exportPDF(w io.Writer, doc Document) error {
+	view, err := viewOf(doc)
+	if err != nil {
+		return err
+	}
+	var lines []string
+	lines = append(lines, view.Title, view.Kind, "")
+	for _, f := range view.Fields {
+		lines = append(lines, wrapText(f.Label+": "+f.Value, pdfWrapColumn)...)
+	}
+	if view.Content != "" {
+		lines = append(lines, "")
+		lines = append(lines, wrapText(view.Content, pdfWrapColumn)...)
+	}
+	for _, list := range view.Lists {
+		lines = append(lines, "", list.Title)
+		for _, item := range list.Items {
+			lines = append(lines, wrapText("  - "+item, pdfWrapColumn)...)
+		}
+	}
+	for _, table := range view.Tables {
+		lines = append(lines, "", table.Title)
+		widths := columnWidths(table)
+		lines = append(lines, formatRow(table.Header, widths)...)
+		for _, row := range table.Rows {
+			lines = append(lines, formatRow(row, widths)...)
+		}
+	}
+	_, err = w.Write(renderPDF(lines))
+	return err
+}
+
+// columnWidths sizes every column of table to its widest line, capped at
+// pdfMaxColumnWidth so one long value cannot push the rest off the page.
+// The last column gets whatever is left of pdfWrapColumn.
+func columnWidths(table viewTable) []int {
+	var widths []int
+	for _, row := range append([][]string{table.Header}, table.Rows...) {
+		for i, cell := range row {
+			if i == len(widths) {
+				widths = append(widths, 0)
+			}
+			for _, line := range strings.Split(cell, "\n") {
+				if n := len(line); n > widths[i] {
+					widths[i] = n
+				}
+			}
+		}
+	}
+	used := 1
+	for i := range widths {
+		if widths[i] > pdfMaxColumnWidth {
+			widths[i] = pdfMaxColumnWidth
+		}
+		if i < len(widths)-1 {
+			used += 1 + widths[i]
+		}
+	}
+	if last := len(widths) - 1; last >= 0 {
+		widths[last] = max(pdfWrapColumn-used-1, pdfMaxColumnWidth)
+	}
+	return widths
+}
+
+// formatRow wraps every cell to its column's width and lays the cells out
+// side by side, so a long value takes more lines in its own column instead
+// of spilling into the next one.
+func formatRow(cells []string, widths []int) []string {
+	columns := make([][]string, len(cells))
+	height := 1
+	for i, cell := range cells {
+		columns[i] = wrapCell(cell, widths[i])
+		height = max(height, len(columns[i]))
+	}
+	lines := make([]string, height)
+	for n := range lines {
+		var b strings.Builder
+		b.WriteString(" ")
+		for i, column := range columns {
+			var line string
+			if n < len(column) {
+				line = column[n]
+			}
+			if i == len(columns)-1 {
+				b.WriteString(" " + line)
+				break
+			}
+			fmt.Fprintf(&b, " %-*s", widths[i], line)
+		}
+		lines[n] = strings.TrimRight(b.String(), " ")
+	}
+	return lines
+}
+
+// wrapCell breaks a cell into lines of at most width bytes, at spaces where
+// it can and inside a word that is longer than the column.
+func wrapCell(cell string, width int) []string {
+	var lines []string
+	for _, paragraph := range strings.Split(cell, "\n") {
+		line := ""
+		for _, word := range strings.Fields(paragraph) {
+			if line != "" && len(line)+1+len(word) <= width {
+				line += " " + word
+				continue
+			}
+			if line != "" {
+				lines = append(lines, line)
+			}
+			for len(word) > width {
+				lines = append(lines, word[:width])
+				word = word[width:]
+			}
+			line = word
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// renderPDF lays out plain text lines on A4 pages using the built-in
+// Helvetica font, so no font files or third-party libraries are needed.
+func renderPDF(lines []string) []byte {
+	var pages [][]string
+	for start := 0; start < len(lines); start += pdfLinesPerPage {
+		end := start + pdfLinesPerPage
+		if end > len(lines) {
+			end = len(lines)
+		}
+		pages = append(pages, lines[start:end])
+	}
+	if len(pages) == 0 {
+		pages = [][]string{nil}
+	}
+
+	// Objects: 1 catalog, 2 page tree, 3 font, then a page and a content
+	// stream for every page.
+	var objects []string
+	kids := make([]string, len(pages))
+	for i := range pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 4+2*i)
+	}
+	objects = append(objects,
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>",
+	)
+	for i, page := range pages {
+		var stream strings.Builder
+		stream.WriteString("BT\n/F1 11 Tf\n14 TL\n50 792 Td\n")
+		for _, line := range page {
+			fmt.Fprintf(&stream, "(%s) '\n", pdfEscape(line))
+		}
+		stream.WriteString("ET")
+		objects = append(objects,
+			fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 595 842] /Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>", 5+2*i),
+			fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", stream.Len(), stream.String()),
+		)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return buf.Bytes()
+}
+
+func pdfEscape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < 32 || r > 126:
+			b.WriteByte('?')
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func wrapText(text string, width int) []string {
+	var lines []string
+	for _, paragraph := range strings.Split(text, "\n") {
+		if len(paragraph) <= width {
+			lines = append(lines, paragraph)
+			continue
+		}
+		words := strings.Fields(paragraph)
+		if len(words) == 0 {
+			lines = append(lines, "")
+			continue
+		}
+		indent := paragraph[:len(paragraph)-len(strings.TrimLeft(paragraph, " "))]
+		line := indent + words[0]
+		for _, word := range words[1:] {
+			if len(line)+1+len(word) > width {
+				lines = append(lines, line)
+				line = indent + "  " + word
+				continue
+			}
+			line += " " + word
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
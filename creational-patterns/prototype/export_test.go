@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+type viewDoc struct {
+	Memo
+	view documentView
+}
+
+func (d *viewDoc) exportView() documentView {
+	return d.view
+}
+
+func TestExportPDFWritesEveryColumn(t *testing.T) {
+	invoice := &Invoice{
+		BaseDocument: BaseDocument{Title: "Invoice"},
+		Currency:     "EUR",
+		Items:        []LineItem{{Description: "Consulting", Quantity: 3, UnitPrice: 120}},
+	}
+	var buf bytes.Buffer
+	if err := Export("pdf", &buf, invoice); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"Unit Price", "Amount", "120.00", "360.00"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("PDF is missing %q", want)
+		}
+	}
+}
+
+func TestExportHandlesNarrowTables(t *testing.T) {
+	doc := &viewDoc{view: documentView{Title: "Narrow", Tables: []viewTable{
+		{Title: "One", Header: []string{"Only"}, Rows: [][]string{{"a"}, {}}},
+		{Title: "Empty"},
+	}}}
+	for _, format := range ExportFormats() {
+		if err := Export(format, &bytes.Buffer{}, doc); err != nil {
+			t.Errorf("%s: %v", format, err)
+		}
+	}
+}
+
+func TestExportMarkdownEscapesValues(t *testing.T) {
+	doc := &viewDoc{view: documentView{
+		Title:  "Q*1*",
+		Fields: []viewField{{"Owner", "a|b **bold** snake_case"}},
+		Tables: []viewTable{{Title: "Data", Header: []string{"Key", "Value"}, Rows: [][]string{{"x|y", "*"}}}},
+	}}
+	var buf bytes.Buffer
+	if err := Export("markdown", &buf, doc); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		`# Q\*1\*`,
+		`- **Owner:** a\|b \*\*bold\*\* snake\_case`,
+		`| x\|y | \* |`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("markdown is missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestExportMarkdownKeepsLineBreaksInsideCells(t *testing.T) {
+	doc := &viewDoc{view: documentView{
+		Title:   "Notes",
+		Fields:  []viewField{{"Owner", "Ann\nBob"}},
+		Content: "First paragraph.\n\nSecond paragraph.",
+		Lists:   []viewList{{Title: "Items", Items: []string{"one\r\ntwo"}}},
+		Tables:  []viewTable{{Title: "Data", Header: []string{"Key", "Value"}, Rows: [][]string{{"note", "line 1\nline 2"}}}},
+	}}
+	var buf bytes.Buffer
+	if err := Export("markdown", &buf, doc); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"- **Owner:** Ann<br>Bob\n",
+		"\nFirst paragraph.\n\nSecond paragraph.\n",
+		"- one<br>two\n",
+		"| note | line 1<br>line 2 |\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("markdown is missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestFormatRowWrapsEachCell(t *testing.T) {
+	table := viewTable{Header: []string{"Key", "Value", "Note"}, Rows: [][]string{
+		{"summary", "alpha beta gamma delta epsilon zeta eta theta iota", "short"},
+		{"id", strings.Repeat("x", 35), "end"},
+	}}
+	widths := columnWidths(table)
+	if widths[0] != 7 || widths[1] != pdfMaxColumnWidth {
+		t.Fatalf("widths = %v", widths)
+	}
+	got := formatRow(table.Rows[0], widths)
+	want := []string{
+		"  summary alpha beta gamma delta epsilon short",
+		"          zeta eta theta iota",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("formatRow =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	got = formatRow(table.Rows[1], widths)
+	want = []string{
+		"  id      " + strings.Repeat("x", 30) + " end",
+		"          xxxxx",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("a long word was not split inside its column:\n%s", strings.Join(got, "\n"))
+	}
+	for _, line := range append(formatRow(table.Rows[0], widths), formatRow(table.Rows[1], widths)...) {
+		if len(line) > pdfWrapColumn {
+			t.Errorf("line longer than the page: %q", line)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// goldenDocuments builds one clone of every document type on a FixedClock,
+// so GetInfo and the exports are the same on every run.
+func goldenDocuments(t *testing.T) map[string]Document {
+	t.Helper()
+	clock := NewFixedClock(time.Date(2024, time.January, 15, 9, 0, 0, 0, time.UTC))
+	author := &Author{Name: "John Doe", Email: "john.doe@example.com", Address: &Address{City: "San Francisco", Country: "USA"}}
+	base := func(title string) BaseDocument {
+		return BaseDocument{ID: "doc-" + title, Title: title, Content: "Body of " + title + ".", Author: author,
+			CreatedAt: clock.Now(), ModifiedAt: clock.Now(), Version: 1}
+	}
+
+	resume := &Resume{BaseDocument: base("resume"), Education: "BS Computer Science"}
+	resume.SetExperience([]string{"Company A - 3 years", "Company B - 2 years"})
+	resume.SetSkills([]string{"Go", "Python"})
+
+	RegisterReportSchema(ReportSchema{ReportType: "golden", Fields: []FieldSpec{
+		{Name: "revenue", Type: FieldInt, Unit: "USD"},
+		{Name: "note", Type: FieldString},
+	}})
+	report := &Report{BaseDocument: base("report"), ReportType: "golden", Department: "Sales", Quarter: "Q1 2024"}
+	if err := report.ReplaceData(map[string]interface{}{"revenue": 1500000, "note": "a|b *c*"}); err != nil {
+		t.Fatal(err)
+	}
+
+	templates := []Document{
+		resume,
+		report,
+		&Invoice{BaseDocument: base("invoice"), Number: "INV-1", Customer: "Acme", Currency: "USD",
+			IssuedAt: clock.Now(), DueAt: clock.Now().AddDate(0, 0, 30),
+			Items: []LineItem{{Description: "Review", Quantity: 2, UnitPrice: 1200}, {Description: "Workshop", Quantity: 1, UnitPrice: 3500}}},
+		&Contract{BaseDocument: base("contract"), Parties: []string{"MyCompany Inc.", "Acme Corp"},
+			EffectiveDate: clock.Now(), ExpiresAt: clock.Now().AddDate(2, 0, 0), Clauses: []string{"Confidentiality", "Term"}},
+		&Letter{BaseDocument: base("letter"), Recipient: "Bob", Salutation: "Dear Bob,", Closing: "Kind regards,"},
+		&Memo{BaseDocument: base("memo"), To: []string{"engineering", "sales"}},
+	}
+	clock.Advance(7 * 24 * time.Hour)
+	docs := make(map[string]Document)
+	for _, template := range templates {
+		template.(lineaged).Base().SetClock(clock)
+		clone := template.Clone()
+		kind := template.(lineaged).Base().Title
+		docs[kind] = clone
+	}
+	return docs
+}
+
+func TestGolden(t *testing.T) {
+	for kind, doc := range goldenDocuments(t) {
+		checkGolden(t, kind+".info", []byte(doc.GetInfo()+"\n"))
+		for _, format := range []string{"markdown", "html", "pdf"} {
+			var buf bytes.Buffer
+			if err := Export(format, &buf, doc); err != nil {
+				t.Errorf("%s as %s: %v", kind, format, err)
+				continue
+			}
+			checkGolden(t, kind+"."+format, buf.Bytes())
+		}
+	}
+}
+
+func checkGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name+".golden")
+	if *update {
+		if err := os.MkdirAll("testdata", 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v (run go test -update to create it)", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s does not match %s:\n--- got ---\n%s\n--- want ---\n%s", name, path, got, want)
+	}
+}
@@ -0,0 +1,318 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	ErrUnknownDocument = errors.New("unknown document")
+	ErrMissingID       = errors.New("document has no ID")
+)
+
+func NewDocumentID() string {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+	return "doc-" + hex.EncodeToString(b[:])
+}
+
+type ChangeKind string
+
+const (
+	FieldAdded    ChangeKind = "added"
+	FieldRemoved  ChangeKind = "removed"
+	FieldModified ChangeKind = "modified"
+)
+
+type FieldChange struct {
+	Path string
+	Kind ChangeKind
+	Old  interface{}
+	New  interface{}
+}
+
+func (c FieldChange) String() string {
+	switch c.Kind {
+	case FieldAdded:
+		return fmt.Sprintf("+ %s: %v", c.Path, c.New)
+	case FieldRemoved:
+		return fmt.Sprintf("- %s: %v", c.Path, c.Old)
+	}
+	return fmt.Sprintf("~ %s: %v -> %v", c.Path, c.Old, c.New)
+}
+
+type lineaged interface {
+	Base() *BaseDocument
+}
+
+type HistoryEntry struct {
+	ID         string
+	ParentID   string
+	Version    int
+	Snapshot   Document
+	Changes    []FieldChange
+	RecordedAt time.Time
+}
+
+type DocumentHistory struct {
+	mu      sync.RWMutex
+	entries map[string]*HistoryEntry
+	clock   Clock
+}
+
+func NewDocumentHistory() *DocumentHistory {
+	return &DocumentHistory{entries: make(map[string]*HistoryEntry), clock: SystemClock{}}
+}
+
+func (h *DocumentHistory) SetClock(clock Clock) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.clock = clockOrSystem(clock)
+}
+
+// Record snapshots doc and, if its parent was recorded, computes the change
+// set against the parent and stores it both in the history entry and in
+// doc's Changes. doc must already have an ID: clones get one from Clone, and
+// templates are expected to set their own.
+func (h *DocumentHistory) Record(doc Document) (HistoryEntry, error) {
+	ld, ok := doc.(lineaged)
+	if !ok {
+		return HistoryEntry{}, fmt.Errorf("history: %T does not embed BaseDocument", doc)
+	}
+	base := ld.Base()
+	if base.ID == "" {
+		return HistoryEntry{}, fmt.Errorf("history: %w", ErrMissingID)
+	}
+	entry := &HistoryEntry{
+		ID:       base.ID,
+		ParentID: base.ParentID,
+		Version:  base.Version,
+		Snapshot: DeepCopy(doc),
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	entry.RecordedAt = h.clock.Now()
+	if parent, ok := h.entries[base.ParentID]; ok {
+		entry.Changes = Diff(parent.Snapshot, entry.Snapshot)
+	}
+	entry.Snapshot.(lineaged).Base().Changes = entry.Changes
+	base.Changes = DeepCopy(entry.Changes)
+	h.entries[entry.ID] = entry
+	return *entry, nil
+}
+
+func (h *DocumentHistory) Get(id string) (HistoryEntry, error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	entry, ok := h.entries[id]
+	if !ok {
+		return HistoryEntry{}, fmt.Errorf("%w: %s", ErrUnknownDocument, id)
+	}
+	return *entry, nil
+}
+
+// Ancestry returns the recorded lineage of id, starting with id itself and
+// ending with the oldest recorded ancestor.
+func (h *DocumentHistory) Ancestry(id string) ([]HistoryEntry, error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	var lineage []HistoryEntry
+	seen := make(map[string]bool)
+	for current := id; current != "" && !seen[current]; {
+		entry, ok := h.entries[current]
+		if !ok {
+			if len(lineage) == 0 {
+				return nil, fmt.Errorf("%w: %s", ErrUnknownDocument, id)
+			}
+			break
+		}
+		seen[current] = true
+		lineage = append(lineage, *entry)
+		current = entry.ParentID
+	}
+	return lineage, nil
+}
+
+func (h *DocumentHistory) Diff(fromID, toID string) ([]FieldChange, error) {
+	from, err := h.Get(fromID)
+	if err != nil {
+		return nil, err
+	}
+	to, err := h.Get(toID)
+	if err != nil {
+		return nil, err
+	}
+	return Diff(from.Snapshot, to.Snapshot), nil
+}
+
+// Diff compares two documents field by field. Slices are compared by index,
+// maps by key, and fields tagged `diff:"-"` are ignored. Unexported fields
+// are only compared when a tag names them, as in `diff:"Data"`. A pair of
+// pointers, maps or slices that has already been compared on the current
+// path is not walked again, so cyclic documents terminate.
+func Diff(from, to Document) []FieldChange {
+	d := &differ{visited: make(map[diffVisit]bool)}
+	d.diff("", reflect.ValueOf(from), reflect.ValueOf(to))
+	return d.changes
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+type diffVisit struct {
+	a, b uintptr
+	typ  reflect.Type
+}
+
+type differ struct {
+	changes []FieldChange
+	visited map[diffVisit]bool
+}
+
+func (d *differ) add(change FieldChange) {
+	d.changes = append(d.changes, change)
+}
+
+// enter reports whether the a/b pair is new, marking it as visited until
+// the returned func is called.
+func (d *differ) enter(a, b reflect.Value) (bool, func()) {
+	key := diffVisit{a.Pointer(), b.Pointer(), a.Type()}
+	if d.visited[key] {
+		return false, nil
+	}
+	d.visited[key] = true
+	return true, func() { delete(d.visited, key) }
+}
+
+func (d *differ) diff(path string, a, b reflect.Value) {
+	if !a.IsValid() || !b.IsValid() {
+		switch {
+		case a.IsValid():
+			d.add(FieldChange{Path: path, Kind: FieldRemoved, Old: a.Interface()})
+		case b.IsValid():
+			d.add(FieldChange{Path: path, Kind: FieldAdded, New: b.Interface()})
+		}
+		return
+	}
+	if a.Type() != b.Type() {
+		d.add(FieldChange{Path: path, Kind: FieldModified, Old: a.Interface(), New: b.Interface()})
+		return
+	}
+
+	switch a.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if a.IsNil() || b.IsNil() {
+			if a.IsNil() != b.IsNil() {
+				d.add(FieldChange{Path: path, Kind: FieldModified, Old: a.Interface(), New: b.Interface()})
+			}
+			return
+		}
+		if a.Kind() == reflect.Pointer {
+			fresh, leave := d.enter(a, b)
+			if !fresh {
+				return
+			}
+			defer leave()
+		}
+		d.diff(path, a.Elem(), b.Elem())
+
+	case reflect.Struct:
+		if a.Type() == timeType {
+			if !a.Interface().(time.Time).Equal(b.Interface().(time.Time)) {
+				d.add(FieldChange{Path: path, Kind: FieldModified, Old: a.Interface(), New: b.Interface()})
+			}
+			return
+		}
+		t := a.Type()
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name, tag := field.Name, field.Tag.Get("diff")
+			af, bf := a.Field(i), b.Field(i)
+			switch {
+			case tag == "-":
+				continue
+			case !field.IsExported():
+				// Unexported fields are only compared when a tag names them.
+				if tag == "" {
+					continue
+				}
+				name = tag
+				a, b = addressable(a), addressable(b)
+				af, bf = exposed(a.Field(i)), exposed(b.Field(i))
+			}
+			fieldPath := joinPath(path, name)
+			if field.Anonymous {
+				fieldPath = path
+			}
+			d.diff(fieldPath, af, bf)
+		}
+
+	case reflect.Slice, reflect.Array:
+		if a.Kind() == reflect.Slice && a.Len() > 0 && b.Len() > 0 {
+			fresh, leave := d.enter(a, b)
+			if !fresh {
+				return
+			}
+			defer leave()
+		}
+		n := a.Len()
+		if b.Len() > n {
+			n = b.Len()
+		}
+		for i := 0; i < n; i++ {
+			var av, bv reflect.Value
+			if i < a.Len() {
+				av = a.Index(i)
+			}
+			if i < b.Len() {
+				bv = b.Index(i)
+			}
+			d.diff(fmt.Sprintf("%s[%d]", path, i), av, bv)
+		}
+
+	case reflect.Map:
+		if !a.IsNil() && !b.IsNil() {
+			fresh, leave := d.enter(a, b)
+			if !fresh {
+				return
+			}
+			defer leave()
+		}
+		keys := make(map[string]reflect.Value)
+		for _, k := range a.MapKeys() {
+			keys[fmt.Sprint(k.Interface())] = k
+		}
+		for _, k := range b.MapKeys() {
+			keys[fmt.Sprint(k.Interface())] = k
+		}
+		names := make([]string, 0, len(keys))
+		for name := range keys {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			k := keys[name]
+			d.diff(joinPath(path, name), a.MapIndex(k), b.MapIndex(k))
+		}
+
+	default:
+		if !reflect.DeepEqual(a.Interface(), b.Interface()) {
+			d.add(FieldChange{Path: path, Kind: FieldModified, Old: a.Interface(), New: b.Interface()})
+		}
+	}
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestRecordStoresChangeSetOnClone(t *testing.T) {
+	history := NewDocumentHistory()
+	template := &Memo{BaseDocument: BaseDocument{ID: "doc-template", Title: "Draft"}, To: []string{"a"}}
+	if _, err := history.Record(template); err != nil {
+		t.Fatal(err)
+	}
+	clone := template.Clone().(*Memo)
+	id := clone.ID
+	clone.SetTitle("Final")
+	clone.To = append(clone.To, "b")
+
+	entry, err := history.Record(clone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if clone.ID != id || entry.ID != id {
+		t.Errorf("Record changed the clone's ID from %s to %s", id, clone.ID)
+	}
+	if clone.ParentID != template.ID {
+		t.Errorf("ParentID = %q, want %q", clone.ParentID, template.ID)
+	}
+	if len(clone.Changes) != 2 || clone.Changes[0].Path != "Title" || clone.Changes[1].Path != "To[1]" {
+		t.Errorf("clone.Changes = %v, want Title and To[1]", clone.Changes)
+	}
+	if again := clone.Clone().(*Memo); again.Changes != nil {
+		t.Errorf("a fresh clone inherited its parent's change set: %v", again.Changes)
+	}
+}
+
+func TestRecordRequiresID(t *testing.T) {
+	memo := &Memo{BaseDocument: BaseDocument{Title: "No ID"}}
+	if _, err := NewDocumentHistory().Record(memo); !errors.Is(err, ErrMissingID) {
+		t.Fatalf("got %v, want ErrMissingID", err)
+	}
+	if memo.ID != "" {
+		t.Errorf("Record assigned ID %q to the caller's document", memo.ID)
+	}
+}
+
+func TestDiffTerminatesOnCycles(t *testing.T) {
+	a := &Report{Data: map[string]interface{}{"n": 1}}
+	a.Data["self"] = a.Data
+	b := &Report{Data: map[string]interface{}{"n": 2}}
+	b.Data["self"] = b.Data
+
+	changes := Diff(a, b)
+	if len(changes) != 1 || changes[0].Path != "Data.n" {
+		t.Fatalf("Diff = %v, want a single Data.n change", changes)
+	}
+}
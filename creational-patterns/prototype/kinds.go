@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+)
+
+var ErrUnknownKind = errors.New("unknown document kind")
+
+// DocumentKind describes a document type to the registry. Only Name and New
+// are required; Clone, Marshal, Unmarshal and Info default to the document's
+// own Clone and GetInfo methods and to encoding/json.
+type DocumentKind struct {
+	Name      string
+	New       func() Document
+	Clone     func(Document) Document
+	Marshal   func(Document) ([]byte, error)
+	Unmarshal func([]byte) (Document, error)
+	Info      func(Document) string
+}
+
+var (
+	kindsMu     sync.RWMutex
+	kindsByName = make(map[string]DocumentKind)
+	kindsByType = make(map[reflect.Type]DocumentKind)
+)
+
+func init() {
+	for _, kind := range []DocumentKind{
+		{Name: "resume", New: func() Document { return &Resume{} }},
+		{Name: "report", New: func() Document { return &Report{} }},
+		{Name: "invoice", New: func() Document { return &Invoice{} }},
+		{Name: "contract", New: func() Document { return &Contract{} }},
+		{Name: "letter", New: func() Document { return &Letter{} }},
+	} {
+		if err := RegisterDocumentKind(kind); err != nil {
+			panic(err)
+		}
+	}
+}
+
+func RegisterDocumentKind(kind DocumentKind) error {
+	if kind.Name == "" || kind.New == nil {
+		return errors.New("document kind needs a Name and a New function")
+	}
+	t := reflect.TypeOf(kind.New())
+	kindsMu.Lock()
+	defer kindsMu.Unlock()
+	if existing, ok := kindsByName[kind.Name]; ok {
+		return fmt.Errorf("document kind %q is already registered for %s", kind.Name, reflect.TypeOf(existing.New()))
+	}
+	if existing, ok := kindsByType[t]; ok {
+		return fmt.Errorf("%s is already registered as document kind %q", t, existing.Name)
+	}
+	kindsByName[kind.Name] = kind
+	kindsByType[t] = kind
+	return nil
+}
+
+func DocumentKinds() []string {
+	kindsMu.RLock()
+	defer kindsMu.RUnlock()
+	names := make([]string, 0, len(kindsByName))
+	for name := range kindsByName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func lookupKind(name string) (DocumentKind, error) {
+	kindsMu.RLock()
+	defer kindsMu.RUnlock()
+	kind, ok := kindsByName[name]
+	if !ok {
+		return DocumentKind{}, fmt.Errorf("%w: %q", ErrUnknownKind, name)
+	}
+	return kind, nil
+}
+
+func kindOf(doc Document) (DocumentKind, error) {
+	kindsMu.RLock()
+	defer kindsMu.RUnlock()
+	kind, ok := kindsByType[reflect.TypeOf(doc)]
+	if !ok {
+		return DocumentKind{}, fmt.Errorf("%w: %T is not registered", ErrUnknownKind, doc)
+	}
+	return kind, nil
+}
+
+func KindOf(doc Document) (string, error) {
+	kind, err := kindOf(doc)
+	return kind.Name, err
+}
+
+func (k DocumentKind) clone(doc Document) Document {
+	if k.Clone != nil {
+		return k.Clone(doc)
+	}
+	return doc.Clone()
+}
+
+func (k DocumentKind) marshal(doc Document) ([]byte, error) {
+	if k.Marshal != nil {
+		return k.Marshal(doc)
+	}
+	return json.Marshal(doc)
+}
+
+func (k DocumentKind) unmarshal(data []byte) (Document, error) {
+	if k.Unmarshal != nil {
+		return k.Unmarshal(data)
+	}
+	doc := k.New()
+	if err := json.Unmarshal(data, doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+func (k DocumentKind) info(doc Document) string {
+	if k.Info != nil {
+		return k.Info(doc)
+	}
+	return doc.GetInfo()
+}
+
+func Describe(doc Document) string {
+	kind, err := kindOf(doc)
+	if err != nil {
+		return doc.GetInfo()
+	}
+	return kind.info(doc)
+}
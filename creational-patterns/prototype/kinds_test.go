@@ -0,0 +1,200 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Memo is a document type defined outside the built-in kinds, the way a
+// plugin would add one. It only provides New and Info, so cloning and
+// serialization use the defaults.
+type Memo struct {
+	BaseDocument
+	To []string
+}
+
+func (m *Memo) Clone() Document {
+	clone := DeepCopy(m)
+	clone.markCloned(&m.BaseDocument)
+	return clone
+}
+
+func (m *Memo) GetInfo() string {
+	return fmt.Sprintf("Memo %q to %s", m.Title, strings.Join(m.To, ", "))
+}
+
+func (m *Memo) SetTitle(title string) {
+	m.Title = title
+}
+
+func (m *Memo) SetContent(content string) {
+	m.Content = content
+}
+
+func (m *Memo) exportView() documentView {
+	view := baseView("Memo", &m.BaseDocument)
+	view.Lists = append(view.Lists, viewList{"To", m.To})
+	return view
+}
+
+func init() {
+	err := RegisterDocumentKind(DocumentKind{
+		Name: "memo",
+		New:  func() Document { return &Memo{} },
+		Info: func(doc Document) string {
+			memo := doc.(*Memo)
+			return fmt.Sprintf("=== MEMO ===\nTitle: %s\nTo: %s", memo.Title, strings.Join(memo.To, ", "))
+		},
+	})
+	if err != nil {
+		panic(err)
+	}
+}
+
+// Note is stored in its own line-based format to exercise every
+// DocumentKind hook.
+type Note struct {
+	BaseDocument
+}
+
+func (n *Note) Clone() Document     { return &Note{BaseDocument: n.BaseDocument} }
+func (n *Note) GetInfo() string     { return "note " + n.Title }
+func (n *Note) SetTitle(t string)   { n.Title = t }
+func (n *Note) SetContent(c string) { n.Content = c }
+
+func TestCustomKindHooks(t *testing.T) {
+	var calls []string
+	err := RegisterDocumentKind(DocumentKind{
+		Name: "note",
+		New:  func() Document { return &Note{} },
+		Clone: func(doc Document) Document {
+			calls = append(calls, "clone")
+			clone := doc.(*Note).Clone().(*Note)
+			clone.Title += " (copy)"
+			return clone
+		},
+		Marshal: func(doc Document) ([]byte, error) {
+			calls = append(calls, "marshal")
+			return json.Marshal("note:" + doc.(*Note).Title)
+		},
+		Unmarshal: func(data []byte) (Document, error) {
+			calls = append(calls, "unmarshal")
+			var s string
+			if err := json.Unmarshal(data, &s); err != nil {
+				return nil, err
+			}
+			title, ok := strings.CutPrefix(s, "note:")
+			if !ok {
+				return nil, errors.New("not a note")
+			}
+			return &Note{BaseDocument: BaseDocument{Title: title}}, nil
+		},
+		Info: func(doc Document) string {
+			calls = append(calls, "info")
+			return "NOTE: " + doc.(*Note).Title
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	r, err := OpenDocumentRegistry(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Register("todo", &Note{BaseDocument: BaseDocument{Title: "Buy milk"}}); err != nil {
+		t.Fatal(err)
+	}
+	reopened, err := OpenDocumentRegistry(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err := reopened.Create("todo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := Describe(doc); got != "NOTE: Buy milk (copy)" {
+		t.Errorf("Describe = %q", got)
+	}
+	if want := []string{"marshal", "unmarshal", "clone", "info"}; !reflect.DeepEqual(calls, want) {
+		t.Errorf("hooks called: %v, want %v", calls, want)
+	}
+	if kind, err := KindOf(doc); err != nil || kind != "note" {
+		t.Errorf("KindOf = %q, %v", kind, err)
+	}
+}
+
+func TestDefaultKindHooks(t *testing.T) {
+	memo := &Memo{BaseDocument: BaseDocument{Title: "All Hands"}, To: []string{"engineering", "sales"}}
+	r, err := OpenDocumentRegistry(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Register("memo", memo); err != nil {
+		t.Fatal(err)
+	}
+	doc, err := r.Create("memo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	created := doc.(*Memo)
+	created.To[0] = "everyone"
+	if memo.To[0] != "engineering" {
+		t.Error("the default clone shares the To slice")
+	}
+	if got, want := Describe(doc), "=== MEMO ===\nTitle: All Hands\nTo: everyone, sales"; got != want {
+		t.Errorf("Describe = %q, want %q", got, want)
+	}
+	if got := Describe(&Letter{BaseDocument: BaseDocument{Title: "Hi"}}); got != (&Letter{BaseDocument: BaseDocument{Title: "Hi"}}).GetInfo() {
+		t.Errorf("a kind without Info should fall back to GetInfo, got %q", got)
+	}
+}
+
+func TestRegisterDocumentKindRejectsDuplicates(t *testing.T) {
+	type unregistered struct{ Letter }
+	for _, kind := range []DocumentKind{
+		{Name: "", New: func() Document { return &Letter{} }},
+		{Name: "no-new"},
+		{Name: "letter", New: func() Document { return &unregistered{} }},
+		{Name: "letter-again", New: func() Document { return &Letter{} }},
+	} {
+		if err := RegisterDocumentKind(kind); err == nil {
+			t.Errorf("RegisterDocumentKind(%q) accepted a bad kind", kind.Name)
+		}
+	}
+	if _, err := KindOf(&unregistered{}); !errors.Is(err, ErrUnknownKind) {
+		t.Errorf("KindOf an unregistered type: got %v", err)
+	}
+	if err := NewDocumentRegistry().Register("x", &unregistered{}); !errors.Is(err, ErrInvalidTemplate) {
+		t.Errorf("Register of an unregistered type: got %v", err)
+	}
+}
+
+func TestListByKind(t *testing.T) {
+	r := NewDocumentRegistry()
+	for name, doc := range map[string]Document{
+		"offer":     &Letter{},
+		"welcome":   &Letter{},
+		"all-hands": &Memo{},
+		"sales":     &Report{ReportType: "untyped"},
+	} {
+		if err := r.Register(name, doc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := []TemplateInfo{{Name: "offer", Kind: "letter", Revision: 1}, {Name: "welcome", Kind: "letter", Revision: 1}}
+	if got := r.ListByKind("letter"); !reflect.DeepEqual(got, want) {
+		t.Errorf("ListByKind(letter) = %v, want %v", got, want)
+	}
+	if got := r.ListByKind("memo"); len(got) != 1 || got[0].Name != "all-hands" {
+		t.Errorf("ListByKind(memo) = %v", got)
+	}
+	if got := r.ListByKind("invoice"); len(got) != 0 {
+		t.Errorf("ListByKind(invoice) = %v, want none", got)
+	}
+}
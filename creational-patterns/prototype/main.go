@@ -2,7 +2,11 @@ package main
 
 import (
 	"fmt"
+	"io"
+	"os"
+	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -18,12 +22,7 @@ type Address struct {
 }
 
 func (a *Address) Clone() *Address {
-	return &Address{
-		Street:  a.Street,
-		City:    a.City,
-		Country: a.Country,
-		ZipCode: a.ZipCode,
-	}
+	return DeepCopy(a)
 }
 
 type Author struct {
@@ -33,11 +32,7 @@ type Author struct {
 }
 
 func (a *Author) Clone() *Author {
-	return &Author{
-		Name:    a.Name,
-		Email:   a.Email,
-		Address: a.Address.Clone(),
-	}
+	return DeepCopy(a)
 }
 
 type Document interface {
@@ -48,41 +43,54 @@ type Document interface {
 }
 
 type BaseDocument struct {
+	ID         string `diff:"-"`
+	ParentID   string `diff:"-"`
 	Title      string
 	Content    string
 	Author     *Author
 	CreatedAt  time.Time
-	ModifiedAt time.Time
-	Version    int
+	ModifiedAt time.Time `diff:"-"`
+	Version    int       `diff:"-"`
+	// Changes is the change set against the parent, filled in when the
+	// document is recorded in a DocumentHistory.
+	Changes []FieldChange `diff:"-" json:"-"`
+	clock   Clock         `clone:"shallow"`
+}
+
+func (b *BaseDocument) Base() *BaseDocument {
+	return b
+}
+
+func (b *BaseDocument) SetClock(clock Clock) {
+	b.clock = clock
+}
+
+func (b *BaseDocument) Clock() Clock {
+	return clockOrSystem(b.clock)
+}
+
+func (b *BaseDocument) markCloned(parent *BaseDocument) {
+	b.ID = NewDocumentID()
+	b.ParentID = parent.ID
+	b.ModifiedAt = parent.Clock().Now()
+	b.Version = parent.Version + 1
+	b.Changes = nil
 }
 
 type Resume struct {
 	BaseDocument
-	Experience []string
-	Skills     []string
+	// experience and skills may be shared with copy-on-write clones, so
+	// they are only reachable through methods that copy before writing.
+	experience []string `diff:"Experience"`
+	skills     []string `diff:"Skills"`
 	Education  string
+	lists      cowState `clone:"-"`
 }
 
 func (r *Resume) Clone() Document {
-	experienceCopy := make([]string, len(r.Experience))
-	copy(experienceCopy, r.Experience)
-	
-	skillsCopy := make([]string, len(r.Skills))
-	copy(skillsCopy, r.Skills)
-	
-	return &Resume{
-		BaseDocument: BaseDocument{
-			Title:      r.Title,
-			Content:    r.Content,
-			Author:     r.Author.Clone(),
-			CreatedAt:  r.CreatedAt,
-			ModifiedAt: time.Now(),
-			Version:    r.Version + 1,
-		},
-		Experience: experienceCopy,
-		Skills:     skillsCopy,
-		Education:  r.Education,
-	}
+	clone := DeepCopy(r)
+	clone.markCloned(&r.BaseDocument)
+	return clone
 }
 
 func (r *Resume) GetInfo() string {
@@ -92,8 +100,8 @@ func (r *Resume) GetInfo() string {
 	info = append(info, fmt.Sprintf("Author: %s (%s)", r.Author.Name, r.Author.Email))
 	info = append(info, fmt.Sprintf("Location: %s, %s", r.Author.Address.City, r.Author.Address.Country))
 	info = append(info, fmt.Sprintf("Education: %s", r.Education))
-	info = append(info, fmt.Sprintf("Skills: %s", strings.Join(r.Skills, ", ")))
-	info = append(info, fmt.Sprintf("Experience: %d positions", len(r.Experience)))
+	info = append(info, fmt.Sprintf("Skills: %s", strings.Join(r.skills, ", ")))
+	info = append(info, fmt.Sprintf("Experience: %d positions", len(r.experience)))
 	info = append(info, fmt.Sprintf("Version: %d", r.Version))
 	info = append(info, fmt.Sprintf("Created: %s", r.CreatedAt.Format("2006-01-02")))
 	info = append(info, fmt.Sprintf("Modified: %s", r.ModifiedAt.Format("2006-01-02")))
@@ -113,29 +121,22 @@ type Report struct {
 	ReportType string
 	Department string
 	Quarter    string
-	Data       map[string]interface{}
+	// Data is checked against the report type's schema when written
+	// through SetData, DeleteData or ReplaceData. Direct writes are only
+	// caught by Validate.
+	Data      map[string]interface{}
+	dataState cowState `clone:"-"`
 }
 
+// Clone returns an eager deep copy with its data normalised to the schema.
+// The Document interface has no error result, so a clone whose data no
+// longer fits (because the schema changed, say) is still returned; Validate
+// on the clone says why, and Registry.Create checks every clone that way.
 func (r *Report) Clone() Document {
-	dataCopy := make(map[string]interface{})
-	for k, v := range r.Data {
-		dataCopy[k] = v
-	}
-	
-	return &Report{
-		BaseDocument: BaseDocument{
-			Title:      r.Title,
-			Content:    r.Content,
-			Author:     r.Author.Clone(),
-			CreatedAt:  r.CreatedAt,
-			ModifiedAt: time.Now(),
-			Version:    r.Version + 1,
-		},
-		ReportType: r.ReportType,
-		Department: r.Department,
-		Quarter:    r.Quarter,
-		Data:       dataCopy,
-	}
+	clone := DeepCopy(r)
+	clone.markCloned(&r.BaseDocument)
+	clone.normalizeData()
+	return clone
 }
 
 func (r *Report) GetInfo() string {
@@ -161,29 +162,9 @@ func (r *Report) SetContent(content string) {
 	r.Content = content
 }
 
-type DocumentRegistry struct {
-	documents map[string]Document
-}
-
-func NewDocumentRegistry() *DocumentRegistry {
-	return &DocumentRegistry{
-		documents: make(map[string]Document),
-	}
-}
-
-func (r *DocumentRegistry) Register(name string, doc Document) {
-	r.documents[name] = doc
-}
-
-func (r *DocumentRegistry) Create(name string) Document {
-	if prototype, exists := r.documents[name]; exists {
-		return prototype.Clone()
-	}
-	return nil
-}
-
 func main() {
-	fmt.Println("=== Prototype Pattern Demo ===\n")
+	fmt.Println("=== Prototype Pattern Demo ===")
+	fmt.Println()
 
 	address := &Address{
 		Street:  "123 Tech Street",
@@ -198,28 +179,44 @@ func main() {
 		Address: address,
 	}
 
+	RegisterReportSchema(ReportSchema{
+		ReportType: "Sales",
+		Fields: []FieldSpec{
+			{Name: "revenue", Type: FieldInt, Unit: "USD"},
+			{Name: "growth", Type: FieldFloat, Unit: "%"},
+			{Name: "customers", Type: FieldInt, Unit: "customers"},
+			{Name: "churn", Type: FieldFloat, Unit: "%"},
+			{Name: "regions", Type: FieldObject},
+		},
+	})
+
+	clock := NewFixedClock(time.Date(2024, time.January, 15, 9, 0, 0, 0, time.UTC))
+
 	fmt.Println("--- Creating Original Resume ---")
 	originalResume := &Resume{
 		BaseDocument: BaseDocument{
 			Title:      "Software Engineer Resume",
 			Content:    "Experienced software engineer...",
 			Author:     author,
-			CreatedAt:  time.Now(),
-			ModifiedAt: time.Now(),
+			CreatedAt:  clock.Now(),
+			ModifiedAt: clock.Now(),
 			Version:    1,
 		},
-		Experience: []string{"Company A - 3 years", "Company B - 2 years"},
-		Skills:     []string{"Go", "Python", "Docker", "Kubernetes"},
-		Education:  "BS Computer Science",
+		Education: "BS Computer Science",
 	}
+	originalResume.SetExperience([]string{"Company A - 3 years", "Company B - 2 years"})
+	originalResume.SetSkills([]string{"Go", "Python", "Docker", "Kubernetes"})
+	originalResume.SetClock(clock)
 	fmt.Println(originalResume.GetInfo())
 
 	fmt.Println("\n--- Cloning Resume and Modifying ---")
+	clock.Advance(7 * 24 * time.Hour)
 	clonedResume := originalResume.Clone().(*Resume)
 	clonedResume.SetTitle("Senior Software Engineer Resume")
 	clonedResume.Author.Name = "Jane Smith"
 	clonedResume.Author.Email = "jane.smith@example.com"
-	clonedResume.Skills = append(clonedResume.Skills, "Rust", "GraphQL")
+	clonedResume.AddSkill("Rust")
+	clonedResume.AddSkill("GraphQL")
 	fmt.Println(clonedResume.GetInfo())
 
 	fmt.Println("\n--- Original Resume (unchanged) ---")
@@ -228,11 +225,12 @@ func main() {
 	fmt.Println("\n--- Creating Original Report ---")
 	originalReport := &Report{
 		BaseDocument: BaseDocument{
+			ID:         NewDocumentID(),
 			Title:      "Q1 Sales Report",
 			Content:    "Sales performance for Q1...",
 			Author:     author,
-			CreatedAt:  time.Now(),
-			ModifiedAt: time.Now(),
+			CreatedAt:  clock.Now(),
+			ModifiedAt: clock.Now(),
 			Version:    1,
 		},
 		ReportType: "Sales",
@@ -242,26 +240,264 @@ func main() {
 			"revenue":   1500000,
 			"growth":    15.5,
 			"customers": 1250,
+			"regions": map[string]interface{}{
+				"north": []interface{}{420000, 380000},
+				"south": []interface{}{350000, 350000},
+			},
 		},
 	}
+	originalReport.SetClock(clock)
 	fmt.Println(originalReport.GetInfo())
 
 	fmt.Println("\n--- Using Document Registry (Prototype Manager) ---")
-	registry := NewDocumentRegistry()
-	registry.Register("resume-template", originalResume)
-	registry.Register("report-template", originalReport)
+	templateDir, err := os.MkdirTemp("", "document-templates")
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	defer os.RemoveAll(templateDir)
+
+	templates, err := OpenDocumentRegistry(templateDir)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	if err := templates.Register("resume-template", originalResume); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	if err := templates.Register("report-template", originalReport); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+
+	fmt.Println("Reopening registry from disk...")
+	registry, err := OpenDocumentRegistry(templateDir)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	registry.SetClock(clock)
+	clock.Advance(30 * 24 * time.Hour)
+	for _, info := range registry.List() {
+		fmt.Printf("Loaded template: %s (%s, revision %d)\n", info.Name, info.Kind, info.Revision)
+	}
+
+	if _, err := registry.Create("invoice-template"); err != nil {
+		fmt.Printf("Error: %v\n", err)
+	}
 
 	fmt.Println("Creating new resume from template...")
-	newResume := registry.Create("resume-template").(*Resume)
+	doc, _ := registry.Create("resume-template")
+	newResume := doc.(*Resume)
 	newResume.SetTitle("DevOps Engineer Resume")
 	newResume.Author.Name = "Bob Johnson"
-	newResume.Skills = []string{"AWS", "Terraform", "Jenkins", "Ansible"}
+	newResume.SetSkills([]string{"AWS", "Terraform", "Jenkins", "Ansible"})
 	fmt.Println(newResume.GetInfo())
 
 	fmt.Println("\n--- Creating new report from template ---")
-	newReport := registry.Create("report-template").(*Report)
+	doc, _ = registry.Create("report-template")
+	newReport := doc.(*Report)
 	newReport.SetTitle("Q2 Sales Report")
 	newReport.Quarter = "Q2 2024"
-	newReport.Data["revenue"] = 1750000
+	newReport.SetData("revenue", 1750000)
+	newReport.Data["regions"].(map[string]interface{})["north"].([]interface{})[0] = 510000
 	fmt.Println(newReport.GetInfo())
+
+	fmt.Println("\n--- Concurrent Registry Access ---")
+	unsubscribe := registry.Subscribe(func(e TemplateEvent) {
+		fmt.Printf("[Registry] %s %s (revision %d)\n", e.Name, e.Kind, e.Revision)
+	})
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			registry.Create("resume-template")
+		}()
+	}
+	wg.Wait()
+	fmt.Println("8 goroutines created resumes from the shared template")
+
+	template, revision, _ := registry.Get("report-template")
+	template.SetTitle("Quarterly Sales Report")
+	if _, err := registry.Update("report-template", template, revision); err != nil {
+		fmt.Printf("Error: %v\n", err)
+	}
+	if _, err := registry.Update("report-template", template, revision); err != nil {
+		fmt.Printf("Stale update rejected: %v\n", err)
+	}
+	registry.Unregister("resume-template")
+	unsubscribe()
+
+	fmt.Println("\n--- Version History and Diffs ---")
+	history := NewDocumentHistory()
+	history.SetClock(clock)
+	if _, err := history.Record(originalReport); err != nil {
+		fmt.Printf("Error: %v\n", err)
+	}
+	q2 := originalReport.Clone().(*Report)
+	q2.SetTitle("Q2 Sales Report")
+	q2.Quarter = "Q2 2024"
+	q2.SetData("revenue", 1750000)
+	q2.SetData("churn", 2.1)
+	history.Record(q2)
+	q3 := q2.Clone().(*Report)
+	q3.SetTitle("Q3 Sales Report")
+	q3.Quarter = "Q3 2024"
+	q3.DeleteData("churn")
+	q3.SetData("revenue", 1610000)
+	history.Record(q3)
+
+	lineage, _ := history.Ancestry(q3.ID)
+	for _, entry := range lineage {
+		fmt.Printf("v%d %s (%d changes from parent)\n", entry.Version, entry.Snapshot.(*Report).Title, len(entry.Changes))
+	}
+	fmt.Println("Changes from template to Q3:")
+	changes, _ := history.Diff(originalReport.ID, q3.ID)
+	for _, change := range changes {
+		fmt.Printf("  %s\n", change)
+	}
+
+	fmt.Println("Changes from original resume to its clone:")
+	for _, change := range Diff(originalResume, clonedResume) {
+		fmt.Printf("  %s\n", change)
+	}
+
+	fmt.Println("\n--- Typed Report Data ---")
+	if err := q3.SetData("revenue", "a lot"); err != nil {
+		fmt.Printf("Rejected: %v\n", err)
+	}
+	if err := q3.SetData("profit", 1); err != nil {
+		fmt.Printf("Rejected: %v\n", err)
+	}
+	growth, err := QuarterOverQuarter([]*Report{q3, originalReport, q2}, "revenue")
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+	}
+	for _, g := range growth {
+		fmt.Printf("Revenue %s\n", g)
+	}
+
+	fmt.Println("\n--- Copy-on-Write Clones ---")
+	registry.SetCloneMode(CopyOnWriteClone)
+	batch := make([]*Report, 1000)
+	for i := range batch {
+		doc, _ := registry.Create("report-template")
+		batch[i] = doc.(*Report)
+	}
+	fmt.Printf("Created %d reports; first shares template data: %v\n", len(batch), batch[0].SharesData())
+	batch[0].SetData("revenue", 2000000)
+	fmt.Printf("After SetData: first shares data: %v, second shares data: %v\n", batch[0].SharesData(), batch[1].SharesData())
+	template, _, _ = registry.Get("report-template")
+	fmt.Printf("Revenue: first=%v second=%v template=%v\n", batch[0].Data["revenue"], batch[1].Data["revenue"], template.(*Report).Data["revenue"])
+	registry.SetCloneMode(EagerClone)
+
+	fmt.Println("\n--- Template Placeholders ---")
+	err = registry.Register("quarterly-template", &Report{
+		BaseDocument: BaseDocument{
+			Title:   "{{quarter}} {{department}} Report",
+			Content: "Prepared by {{author.name}} for {{quarter}}.",
+			Author:  author,
+			Version: 1,
+		},
+		ReportType: "Sales",
+	})
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	names, _ := registry.Placeholders("quarterly-template")
+	fmt.Printf("Placeholders: %s\n", strings.Join(names, ", "))
+	if _, err := registry.Instantiate("quarterly-template", map[string]string{"quarter": "Q4 2024"}, nil); err != nil {
+		fmt.Printf("Error: %v\n", err)
+	}
+	instance, err := registry.Instantiate("quarterly-template",
+		map[string]string{"quarter": "Q4 2024", "author.name": "Jane Smith"},
+		map[string]string{"department": "Sales"})
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+	} else {
+		fmt.Printf("Title: %s\n", instance.(*Report).Title)
+		fmt.Printf("Content: %s\n", instance.(*Report).Content)
+	}
+
+	fmt.Println("\n--- More Document Kinds ---")
+	fmt.Printf("Document kinds: %s\n", strings.Join(DocumentKinds(), ", "))
+	kindTemplates := []struct {
+		name string
+		doc  Document
+	}{
+		{"invoice-template", &Invoice{
+			BaseDocument: BaseDocument{Title: "Consulting Invoice", Author: author, CreatedAt: clock.Now(), ModifiedAt: clock.Now(), Version: 1},
+			Number:       "INV-0001",
+			Customer:     "Acme Corp",
+			Currency:     "USD",
+			IssuedAt:     clock.Now(),
+			DueAt:        clock.Now().AddDate(0, 0, 30),
+			Items: []LineItem{
+				{Description: "Architecture review", Quantity: 2, UnitPrice: 1200},
+				{Description: "On-site workshop", Quantity: 1, UnitPrice: 3500},
+			},
+		}},
+		{"nda-template", &Contract{
+			BaseDocument:  BaseDocument{Title: "Mutual NDA", Author: author, CreatedAt: clock.Now(), ModifiedAt: clock.Now(), Version: 1},
+			Parties:       []string{"MyCompany Inc.", "Acme Corp"},
+			EffectiveDate: clock.Now(),
+			ExpiresAt:     clock.Now().AddDate(2, 0, 0),
+			Clauses:       []string{"Definition of confidential information", "Obligations", "Term"},
+		}},
+		{"offer-letter", &Letter{
+			BaseDocument: BaseDocument{Title: "Offer of Employment", Content: "We are pleased to offer you the position.", Author: author, CreatedAt: clock.Now(), ModifiedAt: clock.Now(), Version: 1},
+			Recipient:    "Bob Johnson",
+			Salutation:   "Dear Bob,",
+			Closing:      "Kind regards,",
+		}},
+	}
+	for _, t := range kindTemplates {
+		if err := registry.Register(t.name, t.doc); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+	}
+	for _, info := range registry.ListByKind("report") {
+		fmt.Printf("Report template: %s\n", info.Name)
+	}
+	doc, _ = registry.Create("invoice-template")
+	invoice := doc.(*Invoice)
+	invoice.Number = "INV-0002"
+	invoice.Items = append(invoice.Items, LineItem{Description: "Follow-up call", Quantity: 3, UnitPrice: 150})
+	fmt.Println(invoice.GetInfo())
+	doc, _ = registry.Create("nda-template")
+	fmt.Println(doc.GetInfo())
+	doc, _ = registry.Create("offer-letter")
+	fmt.Println(doc.GetInfo())
+
+	fmt.Println("\n--- Exporting Documents ---")
+	fmt.Printf("Available formats: %s\n\n", strings.Join(ExportFormats(), ", "))
+	if err := Export("markdown", os.Stdout, q3); err != nil {
+		fmt.Printf("Error: %v\n", err)
+	}
+	for _, format := range []string{"html", "pdf"} {
+		path := filepath.Join(templateDir, "resume."+format)
+		file, err := os.Create(path)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			continue
+		}
+		err = Export(format, file, clonedResume)
+		file.Close()
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			continue
+		}
+		fmt.Printf("\nExported resume as %s to resume.%s\n", strings.ToUpper(format), format)
+	}
+	if err := Export("docx", io.Discard, clonedResume); err != nil {
+		fmt.Printf("Error: %v\n", err)
+	}
+
+	fmt.Println("\n--- Deep Copy of Nested Report Data ---")
+	fmt.Printf("Template north region: %v\n", originalReport.Data["regions"].(map[string]interface{})["north"])
+	fmt.Printf("Clone north region:    %v\n", newReport.Data["regions"].(map[string]interface{})["north"])
 }
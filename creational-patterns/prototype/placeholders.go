@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var placeholderPattern = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_]*(?:\.[A-Za-z_][A-Za-z0-9_]*)*)\s*\}\}`)
+
+type MissingParamsError struct {
+	Template string
+	Names    []string
+}
+
+func (e *MissingParamsError) Error() string {
+	return fmt.Sprintf("template %s: missing parameters: %s", e.Template, strings.Join(e.Names, ", "))
+}
+
+func Placeholders(doc Document) []string {
+	ld, ok := doc.(lineaged)
+	if !ok {
+		return nil
+	}
+	base := ld.Base()
+	seen := make(map[string]bool)
+	var names []string
+	for _, text := range []string{base.Title, base.Content} {
+		for _, m := range placeholderPattern.FindAllStringSubmatch(text, -1) {
+			if !seen[m[1]] {
+				seen[m[1]] = true
+				names = append(names, m[1])
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (r *DocumentRegistry) Placeholders(name string) ([]string, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	entry, exists := r.documents[name]
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrTemplateNotFound, name)
+	}
+	return Placeholders(entry.doc), nil
+}
+
+// Instantiate clones the named template and fills the placeholders in its
+// Title and Content. Values in params win over defaults; a placeholder found
+// in neither is reported in a *MissingParamsError.
+func (r *DocumentRegistry) Instantiate(name string, params, defaults map[string]string) (Document, error) {
+	doc, err := r.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	ld, ok := doc.(lineaged)
+	if !ok {
+		return doc, nil
+	}
+
+	values := make(map[string]string, len(defaults)+len(params))
+	for k, v := range defaults {
+		values[k] = v
+	}
+	for k, v := range params {
+		values[k] = v
+	}
+	var missing []string
+	for _, placeholder := range Placeholders(doc) {
+		if _, ok := values[placeholder]; !ok {
+			missing = append(missing, placeholder)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, &MissingParamsError{Template: name, Names: missing}
+	}
+
+	base := ld.Base()
+	base.Title = fillPlaceholders(base.Title, values)
+	base.Content = fillPlaceholders(base.Content, values)
+	return doc, nil
+}
+
+func fillPlaceholders(text string, values map[string]string) string {
+	return placeholderPattern.ReplaceAllStringFunc(text, func(match string) string {
+		return values[placeholderPattern.FindStringSubmatch(match)[1]]
+	})
+}
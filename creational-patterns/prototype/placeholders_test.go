@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func newPlaceholderRegistry(t *testing.T) *DocumentRegistry {
+	t.Helper()
+	r := NewDocumentRegistry()
+	letter := &Letter{BaseDocument: BaseDocument{
+		Title:   "Offer for {{ name }}",
+		Content: "Dear {{name}}, welcome to {{company.name}} as {{role}}. {{ not a placeholder }}",
+	}}
+	if err := r.Register("offer", letter); err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestPlaceholders(t *testing.T) {
+	r := newPlaceholderRegistry(t)
+	got, err := r.Placeholders("offer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"company.name", "name", "role"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Placeholders = %q, want %q", got, want)
+	}
+	if _, err := r.Placeholders("missing"); !errors.Is(err, ErrTemplateNotFound) {
+		t.Errorf("unknown template: got %v", err)
+	}
+}
+
+func TestInstantiateFillsPlaceholders(t *testing.T) {
+	r := newPlaceholderRegistry(t)
+	doc, err := r.Instantiate("offer",
+		map[string]string{"name": "Ada", "role": "Engineer"},
+		map[string]string{"company.name": "Acme", "role": "Intern"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	letter := doc.(*Letter)
+	if letter.Title != "Offer for Ada" {
+		t.Errorf("Title = %q", letter.Title)
+	}
+	if want := "Dear Ada, welcome to Acme as Engineer. {{ not a placeholder }}"; letter.Content != want {
+		t.Errorf("Content = %q, want %q (params win over defaults)", letter.Content, want)
+	}
+
+	// An empty value is a value, not a missing parameter.
+	doc, err = r.Instantiate("offer", map[string]string{"name": "Ada", "role": "", "company.name": "Acme"}, nil)
+	if err != nil || doc.(*Letter).Content != "Dear Ada, welcome to Acme as . {{ not a placeholder }}" {
+		t.Errorf("empty param: %v, %v", doc, err)
+	}
+
+	template, _, _ := r.Get("offer")
+	if template.(*Letter).Title != "Offer for {{ name }}" {
+		t.Error("Instantiate changed the template")
+	}
+}
+
+func TestInstantiateReportsMissingParams(t *testing.T) {
+	r := newPlaceholderRegistry(t)
+	_, err := r.Instantiate("offer", map[string]string{"role": "Engineer"}, nil)
+	var missing *MissingParamsError
+	if !errors.As(err, &missing) {
+		t.Fatalf("got %v, want a *MissingParamsError", err)
+	}
+	if missing.Template != "offer" || !reflect.DeepEqual(missing.Names, []string{"company.name", "name"}) {
+		t.Errorf("got %+v", missing)
+	}
+	if got, want := err.Error(), "template offer: missing parameters: company.name, name"; got != want {
+		t.Errorf("error = %q, want %q", got, want)
+	}
+	if _, err := r.Instantiate("missing", nil, nil); !errors.Is(err, ErrTemplateNotFound) {
+		t.Errorf("unknown template: got %v", err)
+	}
+}
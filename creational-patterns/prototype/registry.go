@@ -0,0 +1,429 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const templateFormatVersion = 1
+
+var (
+	ErrTemplateNotFound = errors.New("template not found")
+	ErrInvalidTemplate  = errors.New("invalid template")
+	ErrRevisionConflict = errors.New("template revision conflict")
+	templateNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+)
+
+type validator interface {
+	Validate() error
+}
+
+type normalizer interface {
+	normalizeData() error
+}
+
+type templateEnvelope struct {
+	FormatVersion int             `json:"format_version"`
+	Name          string          `json:"name"`
+	Type          string          `json:"type"`
+	Revision      uint64          `json:"revision,omitempty"`
+	Document      json.RawMessage `json:"document"`
+}
+
+type TemplateEventKind string
+
+const (
+	TemplateRegistered   TemplateEventKind = "registered"
+	TemplateUpdated      TemplateEventKind = "updated"
+	TemplateUnregistered TemplateEventKind = "unregistered"
+)
+
+type TemplateEvent struct {
+	Kind     TemplateEventKind
+	Name     string
+	Revision uint64
+}
+
+type TemplateInfo struct {
+	Name     string
+	Kind     string
+	Revision uint64
+}
+
+type templateEntry struct {
+	doc      Document
+	revision uint64
+}
+
+type DocumentRegistry struct {
+	// writeMu serialises Register, Update and Unregister, so template files
+	// and events follow the revision order while mu is only held briefly
+	// and readers are not blocked by file I/O.
+	writeMu     sync.Mutex
+	mu          sync.RWMutex
+	documents   map[string]*templateEntry
+	dir         string
+	subscribers map[int]func(TemplateEvent)
+	nextSubID   int
+	cloneMode   CloneMode
+	clock       Clock
+
+	notifyMu   sync.Mutex
+	queue      []TemplateEvent
+	delivering bool
+}
+
+func NewDocumentRegistry() *DocumentRegistry {
+	return &DocumentRegistry{
+		documents:   make(map[string]*templateEntry),
+		subscribers: make(map[int]func(TemplateEvent)),
+	}
+}
+
+func OpenDocumentRegistry(dir string) (*DocumentRegistry, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	r := NewDocumentRegistry()
+	r.dir = dir
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range paths {
+		name, entry, err := readTemplate(path)
+		if err != nil {
+			return nil, err
+		}
+		r.documents[name] = entry
+	}
+	return r, nil
+}
+
+// SetClock makes every document created from the registry stamp its
+// ModifiedAt, and the ModifiedAt of its own clones, from clock.
+func (r *DocumentRegistry) SetClock(clock Clock) {
+	r.writeMu.Lock()
+	defer r.writeMu.Unlock()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.clock = clock
+	for _, entry := range r.documents {
+		if ld, ok := entry.doc.(lineaged); ok {
+			ld.Base().SetClock(clock)
+		}
+	}
+}
+
+func (r *DocumentRegistry) SetCloneMode(mode CloneMode) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cloneMode = mode
+}
+
+func (r *DocumentRegistry) Register(name string, doc Document) error {
+	_, err := r.put(name, doc, nil)
+	return err
+}
+
+func (r *DocumentRegistry) Update(name string, doc Document, expectedRevision uint64) (uint64, error) {
+	return r.put(name, doc, &expectedRevision)
+}
+
+func (r *DocumentRegistry) put(name string, doc Document, expectedRevision *uint64) (uint64, error) {
+	if !templateNamePattern.MatchString(name) {
+		return 0, fmt.Errorf("%w: bad template name %q", ErrInvalidTemplate, name)
+	}
+	if _, err := kindOf(doc); err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrInvalidTemplate, err)
+	}
+	if v, ok := doc.(validator); ok {
+		if err := v.Validate(); err != nil {
+			return 0, fmt.Errorf("%w: %s: %v", ErrInvalidTemplate, name, err)
+		}
+	}
+	defer r.deliver()
+	r.writeMu.Lock()
+	defer r.writeMu.Unlock()
+
+	r.mu.RLock()
+	current, exists := r.documents[name]
+	clock := r.clock
+	r.mu.RUnlock()
+	var revision uint64
+	if exists {
+		revision = current.revision
+	}
+	if expectedRevision != nil && *expectedRevision != revision {
+		return 0, fmt.Errorf("%w: %s is at revision %d, expected %d", ErrRevisionConflict, name, revision, *expectedRevision)
+	}
+	entry := &templateEntry{doc: DeepCopy(doc), revision: revision + 1}
+	if ld, ok := entry.doc.(lineaged); ok && clock != nil {
+		ld.Base().SetClock(clock)
+	}
+	if n, ok := entry.doc.(normalizer); ok {
+		if err := n.normalizeData(); err != nil {
+			return 0, fmt.Errorf("%w: %s: %v", ErrInvalidTemplate, name, err)
+		}
+	}
+	if r.dir != "" {
+		if err := writeTemplate(r.templatePath(name), name, entry); err != nil {
+			return 0, err
+		}
+	}
+	r.mu.Lock()
+	r.documents[name] = entry
+	r.mu.Unlock()
+
+	kind := TemplateRegistered
+	if exists {
+		kind = TemplateUpdated
+	}
+	r.enqueue(TemplateEvent{Kind: kind, Name: name, Revision: entry.revision})
+	return entry.revision, nil
+}
+
+func (r *DocumentRegistry) Unregister(name string) error {
+	defer r.deliver()
+	r.writeMu.Lock()
+	defer r.writeMu.Unlock()
+
+	r.mu.RLock()
+	entry, exists := r.documents[name]
+	r.mu.RUnlock()
+	if !exists {
+		return fmt.Errorf("%w: %s", ErrTemplateNotFound, name)
+	}
+	if r.dir != "" {
+		if err := os.Remove(r.templatePath(name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	r.mu.Lock()
+	delete(r.documents, name)
+	r.mu.Unlock()
+
+	r.enqueue(TemplateEvent{Kind: TemplateUnregistered, Name: name, Revision: entry.revision})
+	return nil
+}
+
+func (r *DocumentRegistry) Create(name string) (Document, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	entry, exists := r.documents[name]
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrTemplateNotFound, name)
+	}
+	var doc Document
+	if sc, ok := entry.doc.(sharedCloner); ok && r.cloneMode == CopyOnWriteClone {
+		var err error
+		if doc, err = sc.CloneShared(); err != nil {
+			return nil, err
+		}
+	} else {
+		kind, err := kindOf(entry.doc)
+		if err != nil {
+			return nil, err
+		}
+		doc = kind.clone(entry.doc)
+	}
+	if v, ok := doc.(validator); ok {
+		if err := v.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	return doc, nil
+}
+
+func (r *DocumentRegistry) Get(name string) (Document, uint64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	entry, exists := r.documents[name]
+	if !exists {
+		return nil, 0, fmt.Errorf("%w: %s", ErrTemplateNotFound, name)
+	}
+	return DeepCopy(entry.doc), entry.revision, nil
+}
+
+func (r *DocumentRegistry) List() []TemplateInfo {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	infos := make([]TemplateInfo, 0, len(r.documents))
+	for name, entry := range r.documents {
+		kind, _ := KindOf(entry.doc)
+		infos = append(infos, TemplateInfo{Name: name, Kind: kind, Revision: entry.revision})
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos
+}
+
+func (r *DocumentRegistry) ListByKind(kind string) []TemplateInfo {
+	var infos []TemplateInfo
+	for _, info := range r.List() {
+		if info.Kind == kind {
+			infos = append(infos, info)
+		}
+	}
+	return infos
+}
+
+// Subscribe calls fn for every change, one event at a time and in the order
+// the changes were made. Events are delivered after the change is complete
+// and by whichever caller is delivering at the time, so fn may change the
+// registry itself; its own events follow the current one.
+func (r *DocumentRegistry) Subscribe(fn func(TemplateEvent)) (unsubscribe func()) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	id := r.nextSubID
+	r.nextSubID++
+	r.subscribers[id] = fn
+	return func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		delete(r.subscribers, id)
+	}
+}
+
+// enqueue queues an event for delivery. The caller holds writeMu, which
+// fixes the order of the queue.
+func (r *DocumentRegistry) enqueue(event TemplateEvent) {
+	r.notifyMu.Lock()
+	r.queue = append(r.queue, event)
+	r.notifyMu.Unlock()
+}
+
+// deliver sends the queued events to the subscribers unless another call
+// is already doing so.
+func (r *DocumentRegistry) deliver() {
+	r.notifyMu.Lock()
+	if r.delivering {
+		r.notifyMu.Unlock()
+		return
+	}
+	r.delivering = true
+	r.notifyMu.Unlock()
+	drained := false
+	defer func() {
+		if !drained { // a subscriber panicked
+			r.notifyMu.Lock()
+			r.delivering = false
+			r.notifyMu.Unlock()
+		}
+	}()
+	for {
+		r.notifyMu.Lock()
+		if len(r.queue) == 0 {
+			r.delivering, drained = false, true
+			r.notifyMu.Unlock()
+			return
+		}
+		event := r.queue[0]
+		r.queue = r.queue[1:]
+		r.notifyMu.Unlock()
+		r.notify(event)
+	}
+}
+
+func (r *DocumentRegistry) notify(event TemplateEvent) {
+	r.mu.RLock()
+	ids := make([]int, 0, len(r.subscribers))
+	for id := range r.subscribers {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	subscribers := make([]func(TemplateEvent), 0, len(ids))
+	for _, id := range ids {
+		subscribers = append(subscribers, r.subscribers[id])
+	}
+	r.mu.RUnlock()
+	for _, fn := range subscribers {
+		fn(event)
+	}
+}
+
+func (r *DocumentRegistry) templatePath(name string) string {
+	return filepath.Join(r.dir, name+".json")
+}
+
+func writeTemplate(path, name string, entry *templateEntry) error {
+	kind, err := kindOf(entry.doc)
+	if err != nil {
+		return err
+	}
+	body, err := kind.marshal(entry.doc)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(templateEnvelope{
+		FormatVersion: templateFormatVersion,
+		Name:          name,
+		Type:          kind.Name,
+		Revision:      entry.revision,
+		Document:      body,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".template-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func readTemplate(path string) (string, *templateEntry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", nil, err
+	}
+	var envelope templateEnvelope
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return "", nil, fmt.Errorf("%w: %s: %v", ErrInvalidTemplate, path, err)
+	}
+	if envelope.FormatVersion < 1 || envelope.FormatVersion > templateFormatVersion {
+		return "", nil, fmt.Errorf("%w: %s: unsupported format version %d", ErrInvalidTemplate, path, envelope.FormatVersion)
+	}
+	kind, err := lookupKind(envelope.Type)
+	if err != nil {
+		return "", nil, fmt.Errorf("%w: %s: %v", ErrInvalidTemplate, path, err)
+	}
+	fileName := strings.TrimSuffix(filepath.Base(path), ".json")
+	if !templateNamePattern.MatchString(fileName) {
+		return "", nil, fmt.Errorf("%w: %s: file name is not a valid template name", ErrInvalidTemplate, path)
+	}
+	switch envelope.Name {
+	case "":
+		envelope.Name = fileName
+	case fileName:
+	default:
+		return "", nil, fmt.Errorf("%w: %s: template name %q does not match the file name", ErrInvalidTemplate, path, envelope.Name)
+	}
+	doc, err := kind.unmarshal(envelope.Document)
+	if err != nil {
+		return "", nil, fmt.Errorf("%w: %s: %v", ErrInvalidTemplate, path, err)
+	}
+	if n, ok := doc.(normalizer); ok {
+		if err := n.normalizeData(); err != nil {
+			return "", nil, fmt.Errorf("%w: %s: %v", ErrInvalidTemplate, path, err)
+		}
+	}
+	if envelope.Revision == 0 {
+		envelope.Revision = 1
+	}
+	return envelope.Name, &templateEntry{doc: doc, revision: envelope.Revision}, nil
+}
@@ -0,0 +1,304 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestOpenDocumentRegistryChecksTemplateNames(t *testing.T) {
+	tests := []struct {
+		file     string
+		name     string
+		wantErr  bool
+		wantName string
+	}{
+		{file: "memo.json", name: "memo", wantName: "memo"},
+		{file: "memo.json", name: "", wantName: "memo"},
+		{file: "memo.json", name: "other", wantErr: true},
+		{file: "memo.json", name: "../memo", wantErr: true},
+		{file: "-memo.json", name: "-memo", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file+"/"+tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			data := `{"format_version": 1, "name": "` + tt.name + `", "type": "letter", "document": {"Title": "Hi"}}`
+			if err := os.WriteFile(filepath.Join(dir, tt.file), []byte(data), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			r, err := OpenDocumentRegistry(dir)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidTemplate) {
+					t.Fatalf("got %v, want ErrInvalidTemplate", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, _, err := r.Get(tt.wantName); err != nil {
+				t.Errorf("template %q not loaded: %v", tt.wantName, err)
+			}
+		})
+	}
+}
+
+func TestRegistryConcurrentRegisterAndCreate(t *testing.T) {
+	r, err := OpenDocumentRegistry(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Register("letter", &Letter{BaseDocument: BaseDocument{Title: "Hi"}}); err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			name := fmt.Sprintf("letter-%d", i)
+			if err := r.Register(name, &Letter{BaseDocument: BaseDocument{Title: name}}); err != nil {
+				t.Error(err)
+			}
+			if _, err := r.Create(name); err != nil {
+				t.Error(err)
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				doc, err := r.Create("letter")
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				doc.(*Letter).SetTitle("changed")
+			}
+		}()
+	}
+	wg.Wait()
+	if n := len(r.List()); n != 9 {
+		t.Errorf("List has %d templates, want 9", n)
+	}
+	if doc, _, _ := r.Get("letter"); doc.(*Letter).Title != "Hi" {
+		t.Error("changing a created document changed the template")
+	}
+}
+
+func TestUpdateRevisionConflicts(t *testing.T) {
+	r := NewDocumentRegistry()
+	letter := &Letter{BaseDocument: BaseDocument{Title: "v1"}}
+	if _, err := r.Update("letter", letter, 1); !errors.Is(err, ErrRevisionConflict) {
+		t.Errorf("Update of a missing template at revision 1: got %v", err)
+	}
+	if err := r.Register("letter", letter); err != nil {
+		t.Fatal(err)
+	}
+	if rev, err := r.Update("letter", letter, 1); err != nil || rev != 2 {
+		t.Fatalf("Update = %d, %v; want revision 2", rev, err)
+	}
+	if _, err := r.Update("letter", letter, 1); !errors.Is(err, ErrRevisionConflict) {
+		t.Errorf("stale Update: got %v, want ErrRevisionConflict", err)
+	}
+
+	// Of many writers that read the same revision, exactly one wins.
+	var wg sync.WaitGroup
+	var wins, conflicts atomic.Int32
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := r.Update("letter", letter, 2)
+			switch {
+			case err == nil:
+				wins.Add(1)
+			case errors.Is(err, ErrRevisionConflict):
+				conflicts.Add(1)
+			default:
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if wins.Load() != 1 || conflicts.Load() != 15 {
+		t.Errorf("%d updates won and %d conflicted, want 1 and 15", wins.Load(), conflicts.Load())
+	}
+	if _, rev, _ := r.Get("letter"); rev != 3 {
+		t.Errorf("revision = %d, want 3", rev)
+	}
+}
+
+func TestUnregister(t *testing.T) {
+	dir := t.TempDir()
+	r, err := OpenDocumentRegistry(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var events []TemplateEvent
+	r.Subscribe(func(e TemplateEvent) { events = append(events, e) })
+	r.Register("letter", &Letter{BaseDocument: BaseDocument{Title: "Hi"}})
+	if err := r.Unregister("letter"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "letter.json")); !os.IsNotExist(err) {
+		t.Errorf("template file still exists: %v", err)
+	}
+	if _, err := r.Create("letter"); !errors.Is(err, ErrTemplateNotFound) {
+		t.Errorf("Create after Unregister: got %v", err)
+	}
+	if err := r.Unregister("letter"); !errors.Is(err, ErrTemplateNotFound) {
+		t.Errorf("second Unregister: got %v", err)
+	}
+	want := []TemplateEvent{{TemplateRegistered, "letter", 1}, {TemplateUnregistered, "letter", 1}}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("events = %v, want %v", events, want)
+	}
+}
+
+func TestSubscribeDeliversEventsInRevisionOrder(t *testing.T) {
+	r, err := OpenDocumentRegistry(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	letter := &Letter{BaseDocument: BaseDocument{Title: "Hi"}}
+	r.Register("letter", letter)
+
+	var mu sync.Mutex
+	var revisions []uint64
+	unsubscribe := r.Subscribe(func(e TemplateEvent) {
+		mu.Lock()
+		defer mu.Unlock()
+		if e.Name == "letter" {
+			revisions = append(revisions, e.Revision)
+		}
+	})
+	const writers, updates = 8, 10
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := 0; n < updates; {
+				_, rev, _ := r.Get("letter")
+				if _, err := r.Update("letter", letter, rev); err == nil {
+					n++
+				} else if !errors.Is(err, ErrRevisionConflict) {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	unsubscribe()
+	r.Update("letter", letter, writers*updates+1)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(revisions) != writers*updates {
+		t.Fatalf("got %d events, want %d", len(revisions), writers*updates)
+	}
+	for i, rev := range revisions {
+		if rev != uint64(i+2) {
+			t.Fatalf("event %d has revision %d, want %d: events arrived out of order", i, rev, i+2)
+		}
+	}
+}
+
+func TestSubscriberCanChangeTheRegistry(t *testing.T) {
+	r := NewDocumentRegistry()
+	var events []string
+	r.Subscribe(func(e TemplateEvent) {
+		events = append(events, fmt.Sprintf("%s %s", e.Name, e.Kind))
+		if e.Name == "letter" && e.Kind == TemplateRegistered {
+			if err := r.Register("letter-copy", &Letter{}); err != nil {
+				t.Error(err)
+			}
+		}
+	})
+	done := make(chan error, 1)
+	go func() { done <- r.Register("letter", &Letter{}) }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Register deadlocked on a subscriber that calls Register")
+	}
+	want := []string{"letter registered", "letter-copy registered"}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("events = %v, want %v", events, want)
+	}
+}
+
+func TestTemplatesSurviveReopening(t *testing.T) {
+	clock := NewFixedClock(time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC))
+	dir := t.TempDir()
+	saved, err := OpenDocumentRegistry(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved.SetClock(clock)
+	docs := goldenDocuments(t)
+	for name, doc := range docs {
+		if err := saved.Register(name, doc); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+	}
+
+	reopened, err := OpenDocumentRegistry(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reopened.SetClock(clock)
+	if got, want := reopened.List(), saved.List(); !reflect.DeepEqual(got, want) {
+		t.Errorf("reopened List = %v, want %v", got, want)
+	}
+	for name := range docs {
+		want, err := saved.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := reopened.Create(name)
+		if err != nil {
+			t.Errorf("%s: Create after reopening: %v", name, err)
+			continue
+		}
+		if reflect.TypeOf(got) != reflect.TypeOf(want) {
+			t.Errorf("%s: reopened as %T, want %T", name, got, want)
+			continue
+		}
+		if got.GetInfo() != want.GetInfo() {
+			t.Errorf("%s: reopened template differs:\n--- got ---\n%s\n--- want ---\n%s", name, got.GetInfo(), want.GetInfo())
+		}
+		var gotExport, wantExport bytes.Buffer
+		Export("markdown", &gotExport, got)
+		Export("markdown", &wantExport, want)
+		if gotExport.String() != wantExport.String() {
+			t.Errorf("%s: reopened export differs:\n%s\nwant\n%s", name, gotExport.String(), wantExport.String())
+		}
+	}
+}
+
+func TestOpenDocumentRegistryRejectsUnsupportedFormatVersions(t *testing.T) {
+	for _, version := range []int{0, templateFormatVersion + 1} {
+		dir := t.TempDir()
+		data := fmt.Sprintf(`{"format_version": %d, "name": "memo", "type": "letter", "document": {"Title": "Hi"}}`, version)
+		if err := os.WriteFile(filepath.Join(dir, "memo.json"), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		_, err := OpenDocumentRegistry(dir)
+		if !errors.Is(err, ErrInvalidTemplate) || !strings.Contains(err.Error(), fmt.Sprintf("unsupported format version %d", version)) {
+			t.Errorf("format_version %d: got %v, want ErrInvalidTemplate", version, err)
+		}
+	}
+}
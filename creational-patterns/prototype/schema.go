@@ -0,0 +1,322 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var ErrSchemaViolation = errors.New("report data does not match schema")
+
+type FieldType string
+
+const (
+	FieldInt    FieldType = "int"
+	FieldFloat  FieldType = "float"
+	FieldString FieldType = "string"
+	FieldBool   FieldType = "bool"
+	FieldObject FieldType = "object"
+)
+
+type FieldSpec struct {
+	Name     string
+	Type     FieldType
+	Unit     string
+	Required bool
+}
+
+type ReportSchema struct {
+	ReportType string
+	Fields     []FieldSpec
+}
+
+func (s ReportSchema) Field(name string) (FieldSpec, bool) {
+	for _, f := range s.Fields {
+		if f.Name == name {
+			return f, true
+		}
+	}
+	return FieldSpec{}, false
+}
+
+// Coerce converts value to the canonical Go type for the field: int, float64,
+// string, bool or map[string]interface{}. Whole floats (as produced by JSON)
+// are accepted for int fields.
+func (s ReportSchema) Coerce(name string, value interface{}) (interface{}, error) {
+	field, ok := s.Field(name)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s reports have no field %q", ErrSchemaViolation, s.ReportType, name)
+	}
+	converted, ok := coerceValue(field.Type, value)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s.%s must be %s, got %T", ErrSchemaViolation, s.ReportType, name, field.Type, value)
+	}
+	return converted, nil
+}
+
+func (s ReportSchema) Validate(data map[string]interface{}) error {
+	var problems []string
+	for _, field := range s.Fields {
+		if _, ok := data[field.Name]; !ok && field.Required {
+			problems = append(problems, fmt.Sprintf("missing required field %q", field.Name))
+		}
+	}
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if _, err := s.Coerce(k, data[k]); err != nil {
+			problems = append(problems, strings.TrimPrefix(err.Error(), ErrSchemaViolation.Error()+": "))
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: %s", ErrSchemaViolation, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+func coerceValue(t FieldType, value interface{}) (interface{}, bool) {
+	switch t {
+	case FieldInt:
+		switch v := value.(type) {
+		case int:
+			return v, true
+		case int32:
+			return int(v), true
+		case int64:
+			return int(v), true
+		case float64:
+			if v == math.Trunc(v) && math.Abs(v) < 1<<53 {
+				return int(v), true
+			}
+		case json.Number:
+			if n, err := strconv.Atoi(string(v)); err == nil {
+				return n, true
+			}
+		}
+	case FieldFloat:
+		switch v := value.(type) {
+		case float64:
+			return v, true
+		case float32:
+			return float64(v), true
+		case int:
+			return float64(v), true
+		case int64:
+			return float64(v), true
+		case json.Number:
+			if f, err := v.Float64(); err == nil {
+				return f, true
+			}
+		}
+	case FieldString:
+		if v, ok := value.(string); ok {
+			return v, true
+		}
+	case FieldBool:
+		if v, ok := value.(bool); ok {
+			return v, true
+		}
+	case FieldObject:
+		if v, ok := value.(map[string]interface{}); ok {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+var (
+	reportSchemasMu sync.RWMutex
+	reportSchemas   = make(map[string]ReportSchema)
+)
+
+func RegisterReportSchema(schema ReportSchema) {
+	reportSchemasMu.Lock()
+	defer reportSchemasMu.Unlock()
+	reportSchemas[schema.ReportType] = schema
+}
+
+func LookupReportSchema(reportType string) (ReportSchema, bool) {
+	reportSchemasMu.RLock()
+	defer reportSchemasMu.RUnlock()
+	schema, ok := reportSchemas[reportType]
+	return schema, ok
+}
+
+func (r *Report) SetData(key string, value interface{}) error {
+	if schema, ok := LookupReportSchema(r.ReportType); ok {
+		converted, err := schema.Coerce(key, value)
+		if err != nil {
+			return err
+		}
+		value = converted
+	}
+	r.ensureDataOwned()
+	if r.Data == nil {
+		r.Data = make(map[string]interface{})
+	}
+	r.Data[key] = DeepCopy(value)
+	return nil
+}
+
+// ReplaceData swaps in a deep copy of data, normalised to the schema. The
+// report is left unchanged if any value does not fit.
+func (r *Report) ReplaceData(data map[string]interface{}) error {
+	replaced := &Report{ReportType: r.ReportType, Data: DeepCopy(data)}
+	if err := replaced.normalizeData(); err != nil {
+		return err
+	}
+	r.dataState.release()
+	r.Data = replaced.Data
+	return nil
+}
+
+// Value returns a deep copy of one data value.
+func (r *Report) Value(key string) (interface{}, bool) {
+	v, ok := r.Data[key]
+	return DeepCopy(v), ok
+}
+
+func (r *Report) Keys() []string {
+	keys := make([]string, 0, len(r.Data))
+	for k := range r.Data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (r *Report) Validate() error {
+	schema, ok := LookupReportSchema(r.ReportType)
+	if !ok {
+		return nil
+	}
+	return schema.Validate(r.Data)
+}
+
+// normalizeData converts every value to its field's canonical type and
+// reports the values, if any, that do not fit the schema.
+func (r *Report) normalizeData() error {
+	schema, ok := LookupReportSchema(r.ReportType)
+	if !ok {
+		return nil
+	}
+	for k, v := range r.Data {
+		if converted, err := schema.Coerce(k, v); err == nil && !sameType(converted, v) {
+			r.ensureDataOwned()
+			r.Data[k] = converted
+		}
+	}
+	return schema.Validate(r.Data)
+}
+
+func (r *Report) Int(key string) (int, error) {
+	v, ok := coerceValue(FieldInt, r.Data[key])
+	if !ok {
+		return 0, fmt.Errorf("report %q: %s is %T, not an int", r.Title, key, r.Data[key])
+	}
+	return v.(int), nil
+}
+
+func (r *Report) Float(key string) (float64, error) {
+	v, ok := coerceValue(FieldFloat, r.Data[key])
+	if !ok {
+		return 0, fmt.Errorf("report %q: %s is %T, not a number", r.Title, key, r.Data[key])
+	}
+	return v.(float64), nil
+}
+
+func (r *Report) Text(key string) (string, error) {
+	v, ok := r.Data[key].(string)
+	if !ok {
+		return "", fmt.Errorf("report %q: %s is %T, not a string", r.Title, key, r.Data[key])
+	}
+	return v, nil
+}
+
+type Growth struct {
+	From     string
+	To       string
+	Previous float64
+	Current  float64
+	Percent  float64
+	Unit     string
+}
+
+func (g Growth) String() string {
+	format := func(v float64) string {
+		s := strconv.FormatFloat(v, 'f', -1, 64)
+		if g.Unit != "" {
+			s += " " + g.Unit
+		}
+		return s
+	}
+	return fmt.Sprintf("%s -> %s: %s -> %s (%+.1f%%)", g.From, g.To, format(g.Previous), format(g.Current), g.Percent)
+}
+
+// QuarterOverQuarter orders reports by Quarter ("Q1 2024") and returns the
+// growth of a numeric field between consecutive quarters. All reports must
+// share a ReportType so the field means the same thing in each of them.
+func QuarterOverQuarter(reports []*Report, field string) ([]Growth, error) {
+	if len(reports) < 2 {
+		return nil, errors.New("quarter-over-quarter growth needs at least two reports")
+	}
+	type point struct {
+		quarter string
+		key     int
+		value   float64
+	}
+	points := make([]point, 0, len(reports))
+	seen := make(map[int]string)
+	for _, r := range reports {
+		if r.ReportType != reports[0].ReportType {
+			return nil, fmt.Errorf("cannot compare %s and %s reports", reports[0].ReportType, r.ReportType)
+		}
+		key, err := parseQuarter(r.Quarter)
+		if err != nil {
+			return nil, err
+		}
+		if other, dup := seen[key]; dup {
+			return nil, fmt.Errorf("quarter %s appears twice (%q and %q)", r.Quarter, other, r.Title)
+		}
+		seen[key] = r.Title
+		value, err := r.Float(field)
+		if err != nil {
+			return nil, err
+		}
+		points = append(points, point{r.Quarter, key, value})
+	}
+	sort.Slice(points, func(i, j int) bool { return points[i].key < points[j].key })
+	var unit string
+	if schema, ok := LookupReportSchema(reports[0].ReportType); ok {
+		if spec, ok := schema.Field(field); ok {
+			unit = spec.Unit
+		}
+	}
+
+	growth := make([]Growth, 0, len(points)-1)
+	for i := 1; i < len(points); i++ {
+		prev, cur := points[i-1], points[i]
+		g := Growth{From: prev.quarter, To: cur.quarter, Previous: prev.value, Current: cur.value, Unit: unit}
+		if prev.value != 0 {
+			g.Percent = (cur.value - prev.value) / math.Abs(prev.value) * 100
+		}
+		growth = append(growth, g)
+	}
+	return growth, nil
+}
+
+func parseQuarter(quarter string) (int, error) {
+	var q, year int
+	if _, err := fmt.Sscanf(quarter, "Q%d %d", &q, &year); err != nil || q < 1 || q > 4 {
+		return 0, fmt.Errorf("invalid quarter %q, expected e.g. \"Q1 2024\"", quarter)
+	}
+	return year*4 + q - 1, nil
+}
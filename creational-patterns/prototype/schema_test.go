@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestClonesAreCheckedAgainstTheSchema(t *testing.T) {
+	RegisterReportSchema(ReportSchema{ReportType: "clone-check", Fields: []FieldSpec{{Name: "count", Type: FieldString}}})
+	report := &Report{ReportType: "clone-check"}
+	if err := report.SetData("count", "seven"); err != nil {
+		t.Fatal(err)
+	}
+	// The schema changes after the data was written.
+	RegisterReportSchema(ReportSchema{ReportType: "clone-check", Fields: []FieldSpec{{Name: "count", Type: FieldInt}}})
+
+	if err := report.Clone().(*Report).Validate(); !errors.Is(err, ErrSchemaViolation) {
+		t.Errorf("Validate on the clone: got %v, want ErrSchemaViolation", err)
+	}
+	if _, err := report.CloneShared(); !errors.Is(err, ErrSchemaViolation) {
+		t.Errorf("CloneShared: got %v, want ErrSchemaViolation", err)
+	}
+}
+
+func TestReportDataAccessorsCopy(t *testing.T) {
+	report := &Report{ReportType: "untyped"}
+	nested := map[string]interface{}{"north": []interface{}{1, 2}}
+	if err := report.SetData("regions", nested); err != nil {
+		t.Fatal(err)
+	}
+	nested["north"].([]interface{})[0] = 100
+	value, _ := report.Value("regions")
+	value.(map[string]interface{})["north"].([]interface{})[1] = 200
+
+	got, _ := report.Value("regions")
+	if north := got.(map[string]interface{})["north"].([]interface{}); north[0] != 1 || north[1] != 2 {
+		t.Errorf("report data changed through a returned copy: %v", north)
+	}
+}
+
+func TestReplaceDataRejectsInvalidData(t *testing.T) {
+	RegisterReportSchema(ReportSchema{ReportType: "replace-check", Fields: []FieldSpec{{Name: "revenue", Type: FieldInt}}})
+	report := &Report{ReportType: "replace-check"}
+	if err := report.ReplaceData(map[string]interface{}{"revenue": 10.0}); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := report.Value("revenue"); v != 10 {
+		t.Errorf("revenue = %#v, want int 10", v)
+	}
+	if err := report.ReplaceData(map[string]interface{}{"revenue": "lots"}); !errors.Is(err, ErrSchemaViolation) {
+		t.Fatalf("got %v, want ErrSchemaViolation", err)
+	}
+	if v, _ := report.Value("revenue"); v != 10 {
+		t.Errorf("a rejected ReplaceData changed revenue to %#v", v)
+	}
+}
+
+func TestReportJSONKeepsData(t *testing.T) {
+	report := &Report{BaseDocument: BaseDocument{Title: "Q1"}, ReportType: "untyped"}
+	report.SetData("revenue", 5)
+	b, err := json.Marshal(report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded Report
+	if err := json.Unmarshal(b, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := decoded.Value("revenue"); v != 5.0 || decoded.Title != "Q1" {
+		t.Errorf("round trip lost data: %s", b)
+	}
+}
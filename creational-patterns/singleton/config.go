@@ -0,0 +1,346 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+type SourceKind string
+
+const (
+	SourceDefault SourceKind = "default"
+	SourceFile    SourceKind = "file"
+	SourceEnv     SourceKind = "env"
+	SourceFlag    SourceKind = "flag"
+	SourceRuntime SourceKind = "runtime"
+)
+
+type Source struct {
+	Kind SourceKind
+	Name string
+}
+
+func (s Source) String() string {
+	if s.Name == "" {
+		return string(s.Kind)
+	}
+	return fmt.Sprintf("%s:%s", s.Kind, s.Name)
+}
+
+type KeyOrigin struct {
+	Key        string
+	Value      string
+	Source     Source
+	Overridden []Source
+}
+
+// LoadOptions lists the configuration layers from lowest to highest
+// precedence: Defaults, then Files in order, then environment variables
+// starting with EnvPrefix, then command-line Args. Values set at runtime
+// with Set win over all of them.
+type LoadOptions struct {
+	Defaults  map[string]string
+	Files     []string
+	EnvPrefix string
+	Environ   []string
+	Args      []string
+	// SecretKey decrypts values stored as enc:v1:... by SaveFile.
+	SecretKey []byte
+}
+
+type configValue struct {
+	value      string
+	source     Source
+	overridden []Source
+}
+
+type ConfigManager struct {
+	mu          sync.RWMutex
+	loadMu      sync.Mutex
+	settings    map[string]string
+	origins     map[string]configValue
+	overrides   map[string]string
+	options     LoadOptions
+	fingerprint [sha256.Size]byte
+	schema      *ConfigSchema
+	metrics     atomic.Pointer[configMetrics]
+	secrets     []string
+	encrypted   map[string]bool
+	subscribers map[int]func([]ConfigChange)
+	nextSubID   int
+
+	// Changes are queued under loadMu, in the order they were made, and
+	// delivered after it is released, so subscribers may call Set or Load.
+	notifyMu   sync.Mutex
+	queue      [][]ConfigChange
+	delivering bool
+}
+
+func NewConfigManager() *ConfigManager {
+	return &ConfigManager{
+		settings:    make(map[string]string),
+		origins:     make(map[string]configValue),
+		overrides:   make(map[string]string),
+		encrypted:   make(map[string]bool),
+		subscribers: make(map[int]func([]ConfigChange)),
+	}
+}
+
+// Load rebuilds the configuration from opts and swaps it in as a whole, so
+// readers see either the old or the new configuration, never a mix. If any
+// layer fails to load, a secret cannot be resolved, or the result breaks
+// the schema, the previous configuration is kept and the error is returned.
+func (c *ConfigManager) Load(opts LoadOptions) (err error) {
+	defer c.deliver()
+	c.loadMu.Lock()
+	defer c.loadMu.Unlock()
+	defer func() { c.countLoad(err) }()
+
+	origins, fingerprint, err := resolveLayers(opts)
+	if err != nil {
+		return err
+	}
+
+	c.mu.RLock()
+	applyLayer(origins, c.overrides, func(string) Source { return Source{Kind: SourceRuntime} })
+	schema := c.schema
+	c.mu.RUnlock()
+
+	settings := make(map[string]string, len(origins))
+	encrypted := make(map[string]bool)
+	for k, v := range origins {
+		value, wasEncrypted, err := c.resolveSecret(k, v.value, opts)
+		if err != nil {
+			return err
+		}
+		settings[k] = value
+		if wasEncrypted {
+			encrypted[k] = true
+		}
+	}
+	if schema != nil {
+		if err := schema.Validate(settings); err != nil {
+			return redactError(err, c.secretValues(settings))
+		}
+	}
+
+	c.mu.Lock()
+	c.encrypted = encrypted
+	changes := c.markSecretChanges(diffSettings(c.settings, settings))
+	c.options = opts
+	c.fingerprint = fingerprint
+	c.origins = origins
+	c.settings = settings
+	c.mu.Unlock()
+
+	c.enqueue(changes)
+	return nil
+}
+
+// Reload loads the configuration again with the options of the last
+// successful Load.
+func (c *ConfigManager) Reload() error {
+	c.mu.RLock()
+	opts := c.options
+	c.mu.RUnlock()
+	return c.Load(opts)
+}
+
+func (c *ConfigManager) Options() LoadOptions {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.options
+}
+
+func applyLayer(origins map[string]configValue, values map[string]string, source func(key string) Source) {
+	for k, v := range values {
+		prev, exists := origins[k]
+		next := configValue{value: v, source: source(k)}
+		if exists {
+			next.overridden = append(append([]Source(nil), prev.overridden...), prev.source)
+		}
+		origins[k] = next
+	}
+}
+
+// resolveLayers also returns a fingerprint of the file contents it read,
+// which Watch compares against to detect edits.
+func resolveLayers(opts LoadOptions) (map[string]configValue, [sha256.Size]byte, error) {
+	var fingerprint [sha256.Size]byte
+	h := sha256.New()
+	origins := make(map[string]configValue)
+	apply := func(values map[string]string, source func(key string) Source) {
+		applyLayer(origins, values, source)
+	}
+
+	apply(opts.Defaults, func(string) Source { return Source{Kind: SourceDefault} })
+	for _, path := range opts.Files {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fingerprint, fmt.Errorf("config: %w", err)
+		}
+		hashFile(h, path, data)
+		values, err := parseConfigFile(path, data)
+		if err != nil {
+			return nil, fingerprint, err
+		}
+		apply(values, func(string) Source { return Source{Kind: SourceFile, Name: path} })
+	}
+	if opts.EnvPrefix != "" {
+		environ := opts.Environ
+		if environ == nil {
+			environ = os.Environ()
+		}
+		values, names := envValues(opts.EnvPrefix, environ)
+		apply(values, func(k string) Source { return Source{Kind: SourceEnv, Name: names[k]} })
+	}
+	apply(flagValues(opts.Args), func(k string) Source { return Source{Kind: SourceFlag, Name: "--" + k} })
+	copy(fingerprint[:], h.Sum(nil))
+	return origins, fingerprint, nil
+}
+
+// Set overrides key at runtime. The value is rejected if it breaks the
+// schema installed with SetSchema. Secret keys accept file: and env:
+// references, and their values are redacted in the log line.
+func (c *ConfigManager) Set(key, value string) (err error) {
+	defer c.deliver()
+	c.loadMu.Lock()
+	defer c.loadMu.Unlock()
+	defer func() { c.countSet(err) }()
+
+	resolved, _, err := c.resolveSecret(key, value, c.Options())
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	if c.schema != nil {
+		if err := c.schema.ValidateKey(key, resolved); err != nil {
+			c.mu.Unlock()
+			return redactError(err, c.secretValues(map[string]string{key: resolved}))
+		}
+	}
+	prev, exists := c.origins[key]
+	next := configValue{value: value, source: Source{Kind: SourceRuntime}}
+	if exists && prev.source.Kind != SourceRuntime {
+		next.overridden = append(append([]Source(nil), prev.overridden...), prev.source)
+	} else if exists {
+		next.overridden = prev.overridden
+	}
+	old, hadOld := c.settings[key]
+	c.overrides[key] = value
+	c.origins[key] = next
+	c.settings[key] = resolved
+	delete(c.encrypted, key)
+	changes := []ConfigChange{{Key: key, Kind: KeyAdded, New: resolved}}
+	if hadOld {
+		changes = diffSettings(map[string]string{key: old}, map[string]string{key: resolved})
+	}
+	changes = c.markSecretChanges(changes)
+	c.mu.Unlock()
+
+	fmt.Printf("[ConfigManager] Set %s = %s\n", key, c.display(key, value))
+	c.enqueue(changes)
+	return nil
+}
+
+func (c *ConfigManager) Get(key string) string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.settings[key]
+}
+
+func (c *ConfigManager) Lookup(key string) (string, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	value, ok := c.settings[key]
+	return value, ok
+}
+
+// GetAll returns a copy of every setting with secret values redacted. Use
+// Get or the typed getters to read a secret.
+func (c *ConfigManager) GetAll() map[string]string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	result := make(map[string]string, len(c.settings))
+	for k, v := range c.settings {
+		result[k] = c.redactLocked(k, v)
+	}
+	return result
+}
+
+func (c *ConfigManager) values() map[string]string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return copyMap(c.settings)
+}
+
+func (c *ConfigManager) Source(key string) (Source, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	origin, ok := c.origins[key]
+	return origin.source, ok
+}
+
+func (c *ConfigManager) Explain() []KeyOrigin {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	result := make([]KeyOrigin, 0, len(c.origins))
+	for k, v := range c.origins {
+		result = append(result, KeyOrigin{Key: k, Value: c.redactLocked(k, v.value), Source: v.source, Overridden: v.overridden})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Key < result[j].Key })
+	return result
+}
+
+func envValues(prefix string, environ []string) (map[string]string, map[string]string) {
+	values := make(map[string]string)
+	names := make(map[string]string)
+	for _, kv := range environ {
+		name, value, ok := strings.Cut(kv, "=")
+		if !ok || !strings.HasPrefix(name, prefix) || len(name) == len(prefix) {
+			continue
+		}
+		key := envKey(strings.TrimPrefix(name, prefix))
+		values[key] = value
+		names[key] = name
+	}
+	return values, names
+}
+
+// envKey maps an environment variable name to a config key: the name is
+// lowercased and a double underscore separates nested sections, so
+// DATABASE__HOST becomes database.host and LOG_LEVEL becomes log_level.
+func envKey(name string) string {
+	return strings.ReplaceAll(strings.ToLower(name), "__", ".")
+}
+
+// flagValues reads --key=value arguments. Anything else, including
+// positional arguments and negative numbers, is left to the program, and a
+// bare -- ends the flags.
+func flagValues(args []string) map[string]string {
+	values := make(map[string]string)
+	for _, arg := range args {
+		if arg == "--" {
+			break
+		}
+		key, value, ok := strings.Cut(strings.TrimPrefix(arg, "--"), "=")
+		if !ok || key == "" || !strings.HasPrefix(arg, "--") || strings.HasPrefix(key, "-") {
+			continue
+		}
+		values[key] = value
+	}
+	return values
+}
+
+func copyMap(m map[string]string) map[string]string {
+	result := make(map[string]string, len(m))
+	for k, v := range m {
+		result[k] = v
+	}
+	return result
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFlagValuesOnlyReadsKeyEqualsValue(t *testing.T) {
+	args := []string{"serve", "--port=8080", "--offset", "-5", "--verbose", "-x=1", "--=empty", "--", "--after=1"}
+	want := map[string]string{"port": "8080"}
+	if got := flagValues(args); !reflect.DeepEqual(got, want) {
+		t.Errorf("flagValues(%q) = %v, want %v", args, got, want)
+	}
+}
+
+func TestStartupConfigIgnoresProcessArgs(t *testing.T) {
+	if args := startupConfigOptions().Args; len(args) != 0 {
+		t.Errorf("startup options read %q outside of main", args)
+	}
+}
+
+func TestConfigFileListsKeepCommas(t *testing.T) {
+	want := []string{"a,b", "c"}
+	files := map[string]string{
+		"app.json": `{"items": ["a,b", "c"]}`,
+		"app.yaml": "items:\n  - \"a,b\"\n  - c\n",
+		"app.toml": `items = ["a,b", 'c']`,
+		"app.yml":  `items: ["a,b", c]`,
+	}
+	for name, content := range files {
+		values, err := parseConfigFile(name, []byte(content))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		config := NewConfigManager()
+		if err := config.Load(LoadOptions{Defaults: values}); err != nil {
+			t.Fatal(err)
+		}
+		if got, err := config.GetList("items"); err != nil || !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: GetList = %q, %v; want %q", name, got, err, want)
+		}
+	}
+}
+
+func TestEnvListsAreCommaSeparated(t *testing.T) {
+	config := NewConfigManager()
+	if err := config.Load(LoadOptions{EnvPrefix: "APP_", Environ: []string{"APP_ITEMS=a, b,,c"}}); err != nil {
+		t.Fatal(err)
+	}
+	if got := config.GetListOr("items", nil); !reflect.DeepEqual(got, []string{"a", "b", "c"}) {
+		t.Errorf("GetList = %q", got)
+	}
+}
+
+func TestJSONConfigRejectsTrailingData(t *testing.T) {
+	for _, content := range []string{`{"a": 1} {"b": 2}`, `{"a": 1} garbage`, `{"a": 1}]`} {
+		if _, err := parseConfigFile("app.json", []byte(content)); err == nil {
+			t.Errorf("%s: accepted trailing data", content)
+		}
+	}
+	if _, err := parseConfigFile("app.json", []byte("{\"a\": 1}\n\n")); err != nil {
+		t.Errorf("trailing whitespace rejected: %v", err)
+	}
+}
+
+func TestStripComment(t *testing.T) {
+	for line, want := range map[string]string{
+		`motd: "it's # not a comment" # comment`: `motd: "it's # not a comment" `,
+		`motd: it's late # comment`:              `motd: it's late `,
+		`motd = 'say "hi" # here' # comment`:     `motd = 'say "hi" # here' `,
+		`path: "a \" # b" # comment`:             `path: "a \" # b" `,
+		`items: ['a#b', "c"] # comment`:          `items: ['a#b', "c"] `,
+		`color: "#fff"`:                          `color: "#fff"`,
+		`# whole line`:                           ``,
+	} {
+		if got := stripComment(line); got != want {
+			t.Errorf("stripComment(%q) = %q, want %q", line, got, want)
+		}
+	}
+}
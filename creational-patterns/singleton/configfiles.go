@@ -0,0 +1,285 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// parseConfigFile reads a JSON, YAML, TOML or .env file into flat keys.
+// Nested sections are joined with dots (database.host) and lists are stored
+// as JSON arrays, so items may contain commas. The YAML and TOML readers
+// cover the subset used for configuration: nested maps, scalars, lists and
+// comments.
+func parseConfigFile(path string, data []byte) (map[string]string, error) {
+	var err error
+	var values map[string]string
+	switch ext := strings.ToLower(filepath.Ext(path)); {
+	case ext == ".json":
+		values, err = parseJSONConfig(data)
+	case ext == ".yaml" || ext == ".yml":
+		values, err = parseYAMLConfig(data)
+	case ext == ".toml":
+		values, err = parseTOMLConfig(data)
+	case ext == ".env" || filepath.Base(path) == ".env":
+		values, err = parseDotEnv(data)
+	default:
+		return nil, fmt.Errorf("config: %s: unsupported file type %q", path, ext)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("config: %s: %w", path, err)
+	}
+	return values, nil
+}
+
+func parseJSONConfig(data []byte) (map[string]string, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var doc map[string]interface{}
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, fmt.Errorf("unexpected data after the top-level object at offset %d", decoder.InputOffset())
+	}
+	values := make(map[string]string)
+	flattenInto(values, "", doc)
+	return values, nil
+}
+
+func flattenInto(values map[string]string, prefix string, v interface{}) {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(t))
+		for k := range t {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			flattenInto(values, joinKey(prefix, k), t[k])
+		}
+	case []interface{}:
+		items := make([]string, len(t))
+		for i, item := range t {
+			items[i] = fmt.Sprint(item)
+		}
+		values[prefix] = encodeList(items)
+	case nil:
+		values[prefix] = ""
+	default:
+		values[prefix] = fmt.Sprint(t)
+	}
+}
+
+func joinKey(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
+
+func parseYAMLConfig(data []byte) (map[string]string, error) {
+	type frame struct {
+		indent int
+		prefix string
+	}
+	values := make(map[string]string)
+	stack := []frame{{indent: -1}}
+	var listKey string
+	var listIndent int
+	var listItems []string
+	flushList := func() {
+		if listKey != "" && listItems != nil {
+			values[listKey] = encodeList(listItems)
+		}
+		listKey, listItems = "", nil
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		raw := strings.TrimRight(stripComment(scanner.Text()), " \t")
+		trimmed := strings.TrimSpace(raw)
+		if trimmed == "" || trimmed == "---" {
+			continue
+		}
+		if strings.Contains(raw[:len(raw)-len(strings.TrimLeft(raw, " \t"))], "\t") {
+			return nil, fmt.Errorf("line %d: tabs are not allowed for indentation", lineNo)
+		}
+		indent := len(raw) - len(strings.TrimLeft(raw, " "))
+
+		if strings.HasPrefix(trimmed, "- ") || trimmed == "-" {
+			if listKey == "" || indent < listIndent {
+				return nil, fmt.Errorf("line %d: list item outside of a list", lineNo)
+			}
+			listItems = append(listItems, unquote(strings.TrimSpace(strings.TrimPrefix(trimmed, "-"))))
+			continue
+		}
+		flushList()
+
+		key, value, ok := strings.Cut(trimmed, ":")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected \"key: value\"", lineNo)
+		}
+		key, value = strings.TrimSpace(unquote(strings.TrimSpace(key))), strings.TrimSpace(value)
+		for len(stack) > 1 && indent <= stack[len(stack)-1].indent {
+			stack = stack[:len(stack)-1]
+		}
+		fullKey := joinKey(stack[len(stack)-1].prefix, key)
+		switch {
+		case value == "":
+			stack = append(stack, frame{indent: indent, prefix: fullKey})
+			listKey, listIndent = fullKey, indent
+		case strings.HasPrefix(value, "[") && strings.HasSuffix(value, "]"):
+			values[fullKey] = inlineList(value)
+		default:
+			values[fullKey] = unquote(value)
+		}
+	}
+	flushList()
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+func parseTOMLConfig(data []byte) (map[string]string, error) {
+	values := make(map[string]string)
+	section := ""
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(stripComment(scanner.Text()))
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			if !strings.HasSuffix(line, "]") || strings.HasPrefix(line, "[[") {
+				return nil, fmt.Errorf("line %d: unsupported table header %q", lineNo, line)
+			}
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected \"key = value\"", lineNo)
+		}
+		key, value = unquote(strings.TrimSpace(key)), strings.TrimSpace(value)
+		if value == "" {
+			return nil, fmt.Errorf("line %d: missing value for %q", lineNo, key)
+		}
+		if strings.HasPrefix(value, "[") {
+			if !strings.HasSuffix(value, "]") {
+				return nil, fmt.Errorf("line %d: multi-line arrays are not supported", lineNo)
+			}
+			values[joinKey(section, key)] = inlineList(value)
+			continue
+		}
+		values[joinKey(section, key)] = unquote(value)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+func parseDotEnv(data []byte) (map[string]string, error) {
+	values := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		name, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected NAME=value", lineNo)
+		}
+		value = strings.TrimSpace(stripComment(value))
+		values[envKey(strings.TrimSpace(name))] = unquote(value)
+	}
+	return values, scanner.Err()
+}
+
+// stripComment removes a # comment from a YAML or TOML line. A quote only
+// opens a string at the start of a token, so the apostrophe in a bare word
+// such as it's does not hide a comment that follows it.
+func stripComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote == '"' && c == '\\':
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case (c == '"' || c == '\'') && tokenStart(line, i):
+			quote = c
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// tokenStart reports whether line[i] begins a value or key rather than
+// continuing a bare word.
+func tokenStart(line string, i int) bool {
+	return i == 0 || strings.IndexByte(" \t=:[{,", line[i-1]) >= 0
+}
+
+func unquote(s string) string {
+	if len(s) >= 2 {
+		if s[0] == '"' && s[len(s)-1] == '"' {
+			if u, err := strconv.Unquote(s); err == nil {
+				return u
+			}
+		}
+		if s[0] == '\'' && s[len(s)-1] == '\'' {
+			return s[1 : len(s)-1]
+		}
+	}
+	return s
+}
+
+func inlineList(s string) string {
+	items := []string{}
+	inner := s[1 : len(s)-1]
+	inSingle, inDouble, start := false, false, 0
+	for i := 0; i <= len(inner); i++ {
+		if i < len(inner) {
+			switch r := inner[i]; {
+			case r == '\\' && inDouble && i+1 < len(inner):
+				i++
+				continue
+			case r == '\'' && !inDouble:
+				inSingle = !inSingle
+				continue
+			case r == '"' && !inSingle:
+				inDouble = !inDouble
+				continue
+			case r != ',' || inSingle || inDouble:
+				continue
+			}
+		}
+		if item := strings.TrimSpace(inner[start:i]); item != "" {
+			items = append(items, unquote(item))
+		}
+		start = i + 1
+	}
+	return encodeList(items)
+}
+
+// encodeList stores a list from a config file as a JSON array, which
+// parseListValue reads back item for item.
+func encodeList(items []string) string {
+	data, _ := json.Marshal(items)
+	return string(data)
+}
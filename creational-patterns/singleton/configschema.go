@@ -0,0 +1,255 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+var ErrSchemaViolation = errors.New("config does not match schema")
+
+type ValueType string
+
+const (
+	TypeString   ValueType = "string"
+	TypeInt      ValueType = "int"
+	TypeFloat    ValueType = "float"
+	TypeBool     ValueType = "bool"
+	TypeDuration ValueType = "duration"
+	TypeList     ValueType = "list"
+)
+
+// KeySpec describes one configuration key. Min and Max bound int, float and
+// duration values and are written in the key's own type ("10", "1.5",
+// "30s"); empty means unbounded. OneOf, when set, lists the allowed values.
+// Secret marks the key as secret, as MarkSecret does.
+type KeySpec struct {
+	Key      string
+	Type     ValueType
+	Required bool
+	Min      string
+	Max      string
+	OneOf    []string
+	Secret   bool
+}
+
+type ConfigSchema struct {
+	Keys []KeySpec
+}
+
+func (s ConfigSchema) Validate(settings map[string]string) error {
+	var problems []string
+	for _, spec := range s.Keys {
+		value, ok := settings[spec.Key]
+		if !ok {
+			if spec.Required {
+				problems = append(problems, fmt.Sprintf("missing required key %q", spec.Key))
+			}
+			continue
+		}
+		if err := spec.check(value); err != nil {
+			problems = append(problems, strings.TrimPrefix(err.Error(), ErrInvalidValue.Error()+": "))
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: %s", ErrSchemaViolation, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// ValidateKey checks a single value against the key's spec, if it has one.
+func (s ConfigSchema) ValidateKey(key, value string) error {
+	for _, spec := range s.Keys {
+		if spec.Key == key {
+			if err := spec.check(value); err != nil {
+				return fmt.Errorf("%w: %s", ErrSchemaViolation, strings.TrimPrefix(err.Error(), ErrInvalidValue.Error()+": "))
+			}
+		}
+	}
+	return nil
+}
+
+func (spec KeySpec) check(value string) error {
+	switch spec.Type {
+	case TypeString, TypeList:
+	case TypeBool:
+		if _, err := parseBoolValue(spec.Key, value); err != nil {
+			return err
+		}
+	case TypeInt, TypeFloat, TypeDuration:
+		n, err := spec.number(spec.Key, value)
+		if err != nil {
+			return err
+		}
+		if spec.Min != "" {
+			min, err := spec.number(spec.Key+" minimum", spec.Min)
+			if err != nil {
+				return err
+			}
+			if n < min {
+				return fmt.Errorf("%s = %s is below the minimum %s", spec.Key, value, spec.Min)
+			}
+		}
+		if spec.Max != "" {
+			max, err := spec.number(spec.Key+" maximum", spec.Max)
+			if err != nil {
+				return err
+			}
+			if n > max {
+				return fmt.Errorf("%s = %s is above the maximum %s", spec.Key, value, spec.Max)
+			}
+		}
+	default:
+		return fmt.Errorf("%s has unknown type %q", spec.Key, spec.Type)
+	}
+	if len(spec.OneOf) > 0 {
+		for _, allowed := range spec.OneOf {
+			if value == allowed {
+				return nil
+			}
+		}
+		return fmt.Errorf("%s = %q is not one of %s", spec.Key, value, strings.Join(spec.OneOf, ", "))
+	}
+	return nil
+}
+
+func (spec KeySpec) number(key, value string) (float64, error) {
+	switch spec.Type {
+	case TypeInt:
+		n, err := parseIntValue(key, value)
+		return float64(n), err
+	case TypeDuration:
+		d, err := parseDurationValue(key, value)
+		return float64(d), err
+	default:
+		return parseFloatValue(key, value)
+	}
+}
+
+// SetSchema validates the current configuration against schema and, if it
+// passes, checks every later Load, Reload and Set against it too.
+func (c *ConfigManager) SetSchema(schema ConfigSchema) error {
+	c.loadMu.Lock()
+	defer c.loadMu.Unlock()
+	settings := c.values()
+	if err := schema.Validate(settings); err != nil {
+		secrets := c.secretValues(settings)
+		for _, spec := range schema.Keys {
+			if spec.Secret {
+				secrets[spec.Key] = settings[spec.Key]
+			}
+		}
+		return redactError(err, secrets)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.schema = &schema
+	return nil
+}
+
+// Bind copies configuration values into the struct pointed to by dst. Fields
+// are matched by their `config:"key"` tag; a nested struct field's tag names
+// a section whose keys fill the nested struct. Supported field types are
+// string, bool, ints, uints, floats, time.Duration and []string. Keys that
+// are missing leave the field unchanged unless the tag says
+// `config:"key,required"`.
+func (c *ConfigManager) Bind(dst interface{}) error {
+	return c.Section("").Bind(dst)
+}
+
+func (s *ConfigSection) Bind(dst interface{}) error {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Pointer || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("config: Bind needs a non-nil struct pointer, got %T", dst)
+	}
+	return bindStruct(sectionValues(s.config.values(), s.prefix), "", v.Elem())
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+func bindStruct(settings map[string]string, prefix string, v reflect.Value) error {
+	t := v.Type()
+	var problems []error
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag, ok := field.Tag.Lookup("config")
+		if !ok || tag == "-" || !field.IsExported() {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		key := joinKey(prefix, name)
+		fv := v.Field(i)
+		if fv.Kind() == reflect.Struct {
+			if err := bindStruct(settings, key, fv); err != nil {
+				problems = append(problems, err)
+			}
+			continue
+		}
+		value, ok := settings[key]
+		if !ok {
+			if opts == "required" {
+				problems = append(problems, fmt.Errorf("%w: %s", ErrKeyNotFound, key))
+			}
+			continue
+		}
+		if err := setField(fv, key, value); err != nil {
+			problems = append(problems, err)
+		}
+	}
+	return errors.Join(problems...)
+}
+
+func setField(fv reflect.Value, key, value string) error {
+	if fv.Type() == durationType {
+		d, err := parseDurationValue(key, value)
+		if err != nil {
+			return err
+		}
+		fv.SetInt(int64(d))
+		return nil
+	}
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(value)
+	case reflect.Bool:
+		b, err := parseBoolValue(key, value)
+		if err != nil {
+			return err
+		}
+		fv.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := parseIntValue(key, value)
+		if err != nil {
+			return err
+		}
+		if fv.OverflowInt(int64(n)) {
+			return fmt.Errorf("%w: %s = %s overflows %s", ErrInvalidValue, key, value, fv.Type())
+		}
+		fv.SetInt(int64(n))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := parseIntValue(key, value)
+		if err != nil {
+			return err
+		}
+		if n < 0 || fv.OverflowUint(uint64(n)) {
+			return fmt.Errorf("%w: %s = %s does not fit %s", ErrInvalidValue, key, value, fv.Type())
+		}
+		fv.SetUint(uint64(n))
+	case reflect.Float32, reflect.Float64:
+		f, err := parseFloatValue(key, value)
+		if err != nil {
+			return err
+		}
+		fv.SetFloat(f)
+	case reflect.Slice:
+		if fv.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("config: %s: unsupported field type %s", key, fv.Type())
+		}
+		fv.Set(reflect.ValueOf(parseListValue(value)).Convert(fv.Type()))
+	default:
+		return fmt.Errorf("config: %s: unsupported field type %s", key, fv.Type())
+	}
+	return nil
+}
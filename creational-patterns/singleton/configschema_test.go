@@ -0,0 +1,138 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSchemaValidate(t *testing.T) {
+	schema := ConfigSchema{Keys: []KeySpec{
+		{Key: "port", Type: TypeInt, Required: true, Min: "1", Max: "65535"},
+		{Key: "ratio", Type: TypeFloat, Max: "1"},
+		{Key: "timeout", Type: TypeDuration, Min: "1s"},
+		{Key: "log_level", Type: TypeString, OneOf: []string{"debug", "info"}},
+		{Key: "debug", Type: TypeBool},
+	}}
+	valid := map[string]string{"port": "8080", "ratio": "0.5", "timeout": "30s", "log_level": "info", "debug": "false"}
+	if err := schema.Validate(valid); err != nil {
+		t.Errorf("valid settings: %v", err)
+	}
+	if err := schema.Validate(map[string]string{"port": "1", "ratio": "1", "timeout": "1s"}); err != nil {
+		t.Errorf("bounds are inclusive: %v", err)
+	}
+
+	tests := []struct {
+		settings map[string]string
+		want     string
+	}{
+		{map[string]string{}, `missing required key "port"`},
+		{map[string]string{"port": "0"}, "port = 0 is below the minimum 1"},
+		{map[string]string{"port": "70000"}, "port = 70000 is above the maximum 65535"},
+		{map[string]string{"port": "http"}, `port = "http" is not an integer`},
+		{map[string]string{"port": "80", "ratio": "1.5"}, "ratio = 1.5 is above the maximum 1"},
+		{map[string]string{"port": "80", "timeout": "500ms"}, "timeout = 500ms is below the minimum 1s"},
+		{map[string]string{"port": "80", "log_level": "trace"}, `log_level = "trace" is not one of debug, info`},
+		{map[string]string{"port": "80", "debug": "maybe"}, `debug = "maybe" is not a boolean`},
+	}
+	for _, tt := range tests {
+		err := schema.Validate(tt.settings)
+		if !errors.Is(err, ErrSchemaViolation) || err.Error() != ErrSchemaViolation.Error()+": "+tt.want {
+			t.Errorf("Validate(%v) = %v, want %q", tt.settings, err, tt.want)
+		}
+	}
+
+	err := schema.Validate(map[string]string{"port": "0", "log_level": "trace"})
+	if err == nil || !strings.Contains(err.Error(), "minimum 1; log_level") {
+		t.Errorf("every problem should be reported: %v", err)
+	}
+}
+
+func TestSchemaGuardsLaterChanges(t *testing.T) {
+	config := loadTestConfig(t, map[string]string{"port": "0"})
+	schema := ConfigSchema{Keys: []KeySpec{{Key: "port", Type: TypeInt, Min: "1"}}}
+	if err := config.SetSchema(schema); !errors.Is(err, ErrSchemaViolation) {
+		t.Fatalf("SetSchema on an invalid config: got %v", err)
+	}
+	if err := config.Set("port", "8080"); err != nil {
+		t.Fatal(err)
+	}
+	if err := config.SetSchema(schema); err != nil {
+		t.Fatal(err)
+	}
+	if err := config.Set("port", "-1"); !errors.Is(err, ErrSchemaViolation) {
+		t.Errorf("Set: got %v, want ErrSchemaViolation", err)
+	}
+	if got := config.GetIntOr("port", 0); got != 8080 {
+		t.Errorf("a rejected Set was applied: port = %d", got)
+	}
+
+	workers := loadTestConfig(t, map[string]string{"workers": "4"})
+	if err := workers.SetSchema(ConfigSchema{Keys: []KeySpec{{Key: "workers", Type: TypeInt, Min: "1"}}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := workers.Load(LoadOptions{Defaults: map[string]string{"workers": "0"}}); !errors.Is(err, ErrSchemaViolation) {
+		t.Errorf("Load: got %v, want ErrSchemaViolation", err)
+	}
+	if got := workers.GetIntOr("workers", 0); got != 4 {
+		t.Errorf("a rejected Load was applied: workers = %d", got)
+	}
+}
+
+type serverSettings struct {
+	Host    string        `config:"host,required"`
+	Port    uint16        `config:"port"`
+	Timeout time.Duration `config:"timeout"`
+	Tags    []string      `config:"tags"`
+	Ignored string
+	Pool    struct {
+		Size  int8    `config:"size"`
+		Ratio float64 `config:"ratio"`
+		Warm  bool    `config:"warm"`
+	} `config:"pool"`
+}
+
+func TestBind(t *testing.T) {
+	config := loadTestConfig(t, map[string]string{
+		"server.host": "localhost", "server.port": "8080", "server.timeout": "5s", "server.tags": "a,b",
+		"server.pool.size": "10", "server.pool.ratio": "0.5", "server.pool.warm": "on",
+	})
+	settings := serverSettings{Ignored: "kept"}
+	settings.Pool.Size = 1
+	if err := config.Section("server").Bind(&settings); err != nil {
+		t.Fatal(err)
+	}
+	if settings.Host != "localhost" || settings.Port != 8080 || settings.Timeout != 5*time.Second ||
+		len(settings.Tags) != 2 || settings.Ignored != "kept" {
+		t.Errorf("got %+v", settings)
+	}
+	if settings.Pool.Size != 10 || settings.Pool.Ratio != 0.5 || !settings.Pool.Warm {
+		t.Errorf("nested struct: got %+v", settings.Pool)
+	}
+
+	var defaults serverSettings
+	defaults.Port = 80
+	err := loadTestConfig(t, map[string]string{"port": "x", "pool.size": "200"}).Bind(&defaults)
+	for _, want := range []error{ErrKeyNotFound, ErrInvalidValue} {
+		if !errors.Is(err, want) {
+			t.Errorf("got %v, want it to include %v", err, want)
+		}
+	}
+	for _, want := range []string{"config key not found: host", `port = "x" is not an integer`, "pool.size = 200 overflows int8"} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("error %v does not mention %q", err, want)
+		}
+	}
+	if defaults.Port != 80 {
+		t.Errorf("a bad value changed the field: port = %d", defaults.Port)
+	}
+
+	err = loadTestConfig(t, map[string]string{"host": "h", "port": "-1"}).Bind(&defaults)
+	if !errors.Is(err, ErrInvalidValue) || !strings.Contains(err.Error(), "port = -1 does not fit uint16") {
+		t.Errorf("negative uint: got %v", err)
+	}
+	if err := config.Bind(defaults); err == nil {
+		t.Error("Bind accepted a non-pointer")
+	}
+}
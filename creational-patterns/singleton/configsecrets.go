@@ -0,0 +1,296 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+const Redacted = "[REDACTED]"
+
+const encryptedPrefix = "enc:v1:"
+
+var (
+	ErrSecretUnresolved = errors.New("secret reference cannot be resolved")
+	ErrDecrypt          = errors.New("cannot decrypt config value")
+)
+
+// MarkSecret marks the keys matching patterns as secret. Patterns use
+// path.Match syntax, so "*.password" matches database.password. Secret
+// values are redacted in Set's log line, GetAll, Explain, change
+// notifications and schema errors, and may be given as references:
+//
+//	file:/run/secrets/db_password   the file's contents, trailing newline trimmed
+//	env:DB_PASSWORD                 the environment variable's value
+//
+// References are resolved by Load and Set, so mark keys before loading.
+func (c *ConfigManager) MarkSecret(patterns ...string) error {
+	for _, p := range patterns {
+		if _, err := path.Match(p, ""); err != nil {
+			return fmt.Errorf("config: secret pattern %q: %w", p, err)
+		}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.secrets = append(c.secrets, patterns...)
+	return nil
+}
+
+func (c *ConfigManager) IsSecret(key string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.isSecretLocked(key)
+}
+
+func (c *ConfigManager) isSecretLocked(key string) bool {
+	if c.encrypted[key] {
+		return true
+	}
+	if c.schema != nil {
+		for _, spec := range c.schema.Keys {
+			if spec.Key == key && spec.Secret {
+				return true
+			}
+		}
+	}
+	for _, p := range c.secrets {
+		if ok, _ := path.Match(p, key); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *ConfigManager) redactLocked(key, value string) string {
+	if !c.isSecretLocked(key) {
+		return value
+	}
+	if isSecretReference(value) {
+		return value
+	}
+	return Redacted
+}
+
+// display is the form of value that is safe to print: secrets are
+// redacted, but a reference to a secret is not itself secret.
+func (c *ConfigManager) display(key, value string) string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.redactLocked(key, value)
+}
+
+func (c *ConfigManager) markSecretChanges(changes []ConfigChange) []ConfigChange {
+	for i := range changes {
+		changes[i].Secret = c.isSecretLocked(changes[i].Key)
+	}
+	return changes
+}
+
+type redactedError struct {
+	msg string
+	err error
+}
+
+func (e *redactedError) Error() string { return e.msg }
+func (e *redactedError) Unwrap() error { return e.err }
+
+// secretValues returns the entries of values whose keys are secret.
+func (c *ConfigManager) secretValues(values map[string]string) map[string]string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	secrets := make(map[string]string)
+	for k, v := range values {
+		if c.isSecretLocked(k) {
+			secrets[k] = v
+		}
+	}
+	return secrets
+}
+
+// redactError removes secret values from err's message while keeping err
+// in the chain for errors.Is.
+func redactError(err error, secrets map[string]string) error {
+	msg := err.Error()
+	for _, v := range secrets {
+		if v != "" {
+			msg = strings.ReplaceAll(msg, v, Redacted)
+		}
+	}
+	if msg == err.Error() {
+		return err
+	}
+	return &redactedError{msg: msg, err: err}
+}
+
+func isSecretReference(value string) bool {
+	return strings.HasPrefix(value, "file:") || strings.HasPrefix(value, "env:")
+}
+
+// resolveSecret decrypts enc:v1: values for any key and follows file: and
+// env: references for secret keys. Other values are returned unchanged.
+func (c *ConfigManager) resolveSecret(key, value string, opts LoadOptions) (string, bool, error) {
+	if strings.HasPrefix(value, encryptedPrefix) {
+		plain, err := decryptValue(opts.SecretKey, key, value)
+		return plain, true, err
+	}
+	if !c.IsSecret(key) {
+		return value, false, nil
+	}
+	if name, ok := strings.CutPrefix(value, "file:"); ok {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return "", false, fmt.Errorf("%w: %s: %w", ErrSecretUnresolved, key, err)
+		}
+		return strings.TrimRight(string(data), "\r\n"), false, nil
+	}
+	if name, ok := strings.CutPrefix(value, "env:"); ok {
+		if v, found := lookupEnv(opts.Environ, name); found {
+			return v, false, nil
+		}
+		return "", false, fmt.Errorf("%w: %s: environment variable %s is not set", ErrSecretUnresolved, key, name)
+	}
+	return value, false, nil
+}
+
+func lookupEnv(environ []string, name string) (string, bool) {
+	if environ == nil {
+		return os.LookupEnv(name)
+	}
+	for _, kv := range environ {
+		if k, v, ok := strings.Cut(kv, "="); ok && k == name {
+			return v, true
+		}
+	}
+	return "", false
+}
+
+// SaveFile writes the configuration to a JSON file that Load can read
+// back. Secret keys given as references are saved as the reference. Other
+// secret values are encrypted with AES-GCM under secretKey. If secretKey is
+// nil, values that were loaded encrypted keep their ciphertext and other
+// secrets are written in plain text. The file is created with mode 0600 and
+// replaced atomically.
+func (c *ConfigManager) SaveFile(filename string, secretKey []byte) error {
+	c.mu.RLock()
+	doc := make(map[string]string, len(c.origins))
+	var err error
+	for k, v := range c.origins {
+		value := v.value
+		if strings.HasPrefix(value, encryptedPrefix) {
+			if secretKey == nil {
+				doc[k] = value
+				continue
+			}
+			value = c.settings[k]
+		}
+		if secretKey != nil && c.isSecretLocked(k) && !isSecretReference(value) {
+			if value, err = encryptValue(secretKey, k, value); err != nil {
+				break
+			}
+		}
+		doc[k] = value
+	}
+	c.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(filename), filepath.Base(filename)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filename)
+}
+
+// GenerateKeyFile writes a new random 256-bit key, hex encoded, to
+// filename with mode 0600. It refuses to overwrite an existing key.
+func GenerateKeyFile(filename string) ([]byte, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.WriteString(hex.EncodeToString(key) + "\n"); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return key, f.Close()
+}
+
+func ReadKeyFile(filename string) ([]byte, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	key, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(key) != 32 {
+		return nil, fmt.Errorf("config: %s does not hold a hex-encoded 256-bit key", filename)
+	}
+	return key, nil
+}
+
+// The config key is used as additional authenticated data, so an encrypted
+// value copied to a different key fails to decrypt.
+func encryptValue(secretKey []byte, key, plain string) (string, error) {
+	gcm, err := newGCM(secretKey)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(plain), []byte(key))
+	return encryptedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func decryptValue(secretKey []byte, key, value string) (string, error) {
+	if secretKey == nil {
+		return "", fmt.Errorf("%w: %s is encrypted and no SecretKey was given", ErrDecrypt, key)
+	}
+	gcm, err := newGCM(secretKey)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, encryptedPrefix))
+	if err != nil || len(sealed) < gcm.NonceSize() {
+		return "", fmt.Errorf("%w: %s is malformed", ErrDecrypt, key)
+	}
+	plain, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], []byte(key))
+	if err != nil {
+		return "", fmt.Errorf("%w: %s: wrong key or tampered value", ErrDecrypt, key)
+	}
+	return string(plain), nil
+}
+
+func newGCM(secretKey []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(secretKey)
+	if err != nil {
+		return nil, fmt.Errorf("config: secret key: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSecretsAreRedacted(t *testing.T) {
+	config := NewConfigManager()
+	config.MarkSecret("*.password")
+	err := config.Load(LoadOptions{Defaults: map[string]string{"database.password": "hunter2", "database.user": "app"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := config.Get("database.password"); got != "hunter2" {
+		t.Errorf("Get = %q, want the real value", got)
+	}
+	if got := config.GetAll(); got["database.password"] != Redacted || got["database.user"] != "app" {
+		t.Errorf("GetAll = %v", got)
+	}
+	for _, origin := range config.Explain() {
+		if origin.Key == "database.password" && origin.Value != Redacted {
+			t.Errorf("Explain shows %q", origin.Value)
+		}
+	}
+
+	var changes []ConfigChange
+	config.Subscribe(func(c []ConfigChange) { changes = append(changes, c...) })
+	if err := config.Set("database.password", "correct-horse"); err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 1 || !changes[0].Secret || changes[0].New != "correct-horse" {
+		t.Fatalf("changes = %+v, want one secret change carrying the real value", changes)
+	}
+	if s := changes[0].String(); strings.Contains(s, "hunter2") || strings.Contains(s, "correct-horse") {
+		t.Errorf("change prints the secret: %s", s)
+	}
+
+	err = config.SetSchema(ConfigSchema{Keys: []KeySpec{{Key: "database.password", OneOf: []string{"a", "b"}}}})
+	if !errors.Is(err, ErrSchemaViolation) || strings.Contains(err.Error(), "correct-horse") {
+		t.Errorf("SetSchema error = %v, want a redacted ErrSchemaViolation", err)
+	}
+	config.SetSchema(ConfigSchema{Keys: []KeySpec{{Key: "api_token", Type: TypeInt, Secret: true}}})
+	err = config.Set("api_token", "tok-123")
+	if !errors.Is(err, ErrSchemaViolation) || strings.Contains(err.Error(), "tok-123") {
+		t.Errorf("Set error = %v, want a redacted ErrSchemaViolation", err)
+	}
+}
+
+func TestSecretReferences(t *testing.T) {
+	dir := t.TempDir()
+	secretFile := filepath.Join(dir, "db_password")
+	os.WriteFile(secretFile, []byte("from-file\n"), 0o600)
+
+	config := NewConfigManager()
+	config.MarkSecret("*.password", "api_token")
+	err := config.Load(LoadOptions{
+		Defaults: map[string]string{
+			"database.password": "file:" + secretFile,
+			"api_token":         "env:API_TOKEN",
+			"plain":             "env:API_TOKEN",
+		},
+		Environ: []string{"API_TOKEN=from-env"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, want := range map[string]string{"database.password": "from-file", "api_token": "from-env", "plain": "env:API_TOKEN"} {
+		if got := config.Get(key); got != want {
+			t.Errorf("Get(%q) = %q, want %q", key, got, want)
+		}
+	}
+	if got := config.GetAll()["api_token"]; got != Redacted {
+		t.Errorf("GetAll shows %q, want it redacted", got)
+	}
+	for _, origin := range config.Explain() {
+		if origin.Key == "api_token" && origin.Value != "env:API_TOKEN" {
+			t.Errorf("Explain shows %q, want the reference", origin.Value)
+		}
+	}
+
+	for _, value := range []string{"file:" + filepath.Join(dir, "missing"), "env:UNSET"} {
+		err := config.Load(LoadOptions{Defaults: map[string]string{"api_token": value}, Environ: []string{}})
+		if !errors.Is(err, ErrSecretUnresolved) {
+			t.Errorf("%s: got %v, want ErrSecretUnresolved", value, err)
+		}
+	}
+	if got := config.Get("api_token"); got != "from-env" {
+		t.Errorf("a failed Load replaced the configuration: api_token = %q", got)
+	}
+}
+
+func TestEncryptedSaveAndLoad(t *testing.T) {
+	dir := t.TempDir()
+	key, err := GenerateKeyFile(filepath.Join(dir, "config.key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := NewConfigManager()
+	config.MarkSecret("*.password")
+	config.Load(LoadOptions{Defaults: map[string]string{"database.password": "hunter2", "database.user": "app"}})
+	saved := filepath.Join(dir, "saved.json")
+	if err := config.SaveFile(saved, key); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(saved)
+	if strings.Contains(string(data), "hunter2") || !strings.Contains(string(data), encryptedPrefix) {
+		t.Fatalf("saved file is not encrypted:\n%s", data)
+	}
+	if info, _ := os.Stat(saved); info.Mode().Perm() != 0o600 {
+		t.Errorf("saved file mode = %v, want 0600", info.Mode().Perm())
+	}
+
+	restored := NewConfigManager()
+	if err := restored.Load(LoadOptions{Files: []string{saved}}); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("Load without the key: got %v, want ErrDecrypt", err)
+	}
+	if err := restored.Load(LoadOptions{Files: []string{saved}, SecretKey: key}); err != nil {
+		t.Fatal(err)
+	}
+	if got := restored.Get("database.password"); got != "hunter2" {
+		t.Errorf("decrypted password = %q", got)
+	}
+	if !restored.IsSecret("database.password") || restored.GetAll()["database.password"] != Redacted {
+		t.Error("a value loaded encrypted is not treated as secret")
+	}
+
+	// Saving without a key keeps the ciphertext instead of the plain text.
+	resaved := filepath.Join(dir, "resaved.json")
+	if err := restored.SaveFile(resaved, nil); err != nil {
+		t.Fatal(err)
+	}
+	data, _ = os.ReadFile(resaved)
+	if strings.Contains(string(data), "hunter2") || !strings.Contains(string(data), encryptedPrefix) {
+		t.Fatalf("SaveFile(nil) wrote the secret in plain text:\n%s", data)
+	}
+	again := NewConfigManager()
+	if err := again.Load(LoadOptions{Files: []string{resaved}, SecretKey: key}); err != nil || again.Get("database.password") != "hunter2" {
+		t.Errorf("reloading the resaved file: %q, %v", again.Get("database.password"), err)
+	}
+
+	// The key name is authenticated, so ciphertext moved to another key
+	// does not decrypt.
+	sealed, _ := encryptValue(key, "database.password", "hunter2")
+	if _, err := decryptValue(key, "other.password", sealed); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("moved ciphertext: got %v, want ErrDecrypt", err)
+	}
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrKeyNotFound  = errors.New("config key not found")
+	ErrInvalidValue = errors.New("invalid config value")
+)
+
+// ConfigSection is a view of the keys under a dotted prefix. Its getters
+// read the live configuration, so a section taken before a reload sees the
+// reloaded values.
+type ConfigSection struct {
+	config *ConfigManager
+	prefix string
+}
+
+func (c *ConfigManager) Section(prefix string) *ConfigSection {
+	return &ConfigSection{config: c, prefix: prefix}
+}
+
+func (s *ConfigSection) Section(name string) *ConfigSection {
+	return &ConfigSection{config: s.config, prefix: joinKey(s.prefix, name)}
+}
+
+// Keys returns the keys in the section relative to its prefix, sorted.
+func (s *ConfigSection) Keys() []string {
+	var keys []string
+	for k := range s.Map() {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Map returns the section's values keyed relative to its prefix, with
+// secrets redacted as in GetAll.
+func (s *ConfigSection) Map() map[string]string {
+	return sectionValues(s.config.GetAll(), s.prefix)
+}
+
+func sectionValues(all map[string]string, prefix string) map[string]string {
+	if prefix == "" {
+		return all
+	}
+	result := make(map[string]string)
+	for k, v := range all {
+		if rest, ok := strings.CutPrefix(k, prefix+"."); ok {
+			result[rest] = v
+		}
+	}
+	return result
+}
+
+func (s *ConfigSection) lookup(key string) (string, string, error) {
+	full := joinKey(s.prefix, key)
+	value, ok := s.config.Lookup(full)
+	if !ok {
+		return "", full, fmt.Errorf("%w: %s", ErrKeyNotFound, full)
+	}
+	return value, full, nil
+}
+
+func (s *ConfigSection) GetString(key string) (string, error) {
+	value, _, err := s.lookup(key)
+	return value, err
+}
+
+func (s *ConfigSection) GetInt(key string) (int, error) {
+	value, full, err := s.lookup(key)
+	if err != nil {
+		return 0, err
+	}
+	return parseIntValue(full, value)
+}
+
+func (s *ConfigSection) GetFloat(key string) (float64, error) {
+	value, full, err := s.lookup(key)
+	if err != nil {
+		return 0, err
+	}
+	return parseFloatValue(full, value)
+}
+
+func (s *ConfigSection) GetBool(key string) (bool, error) {
+	value, full, err := s.lookup(key)
+	if err != nil {
+		return false, err
+	}
+	return parseBoolValue(full, value)
+}
+
+func (s *ConfigSection) GetDuration(key string) (time.Duration, error) {
+	value, full, err := s.lookup(key)
+	if err != nil {
+		return 0, err
+	}
+	return parseDurationValue(full, value)
+}
+
+func (s *ConfigSection) GetList(key string) ([]string, error) {
+	value, _, err := s.lookup(key)
+	if err != nil {
+		return nil, err
+	}
+	return parseListValue(value), nil
+}
+
+// The ...Or getters return def when the key is missing or its value does
+// not parse.
+
+func (s *ConfigSection) GetStringOr(key, def string) string {
+	if value, err := s.GetString(key); err == nil {
+		return value
+	}
+	return def
+}
+
+func (s *ConfigSection) GetIntOr(key string, def int) int {
+	if value, err := s.GetInt(key); err == nil {
+		return value
+	}
+	return def
+}
+
+func (s *ConfigSection) GetFloatOr(key string, def float64) float64 {
+	if value, err := s.GetFloat(key); err == nil {
+		return value
+	}
+	return def
+}
+
+func (s *ConfigSection) GetBoolOr(key string, def bool) bool {
+	if value, err := s.GetBool(key); err == nil {
+		return value
+	}
+	return def
+}
+
+func (s *ConfigSection) GetDurationOr(key string, def time.Duration) time.Duration {
+	if value, err := s.GetDuration(key); err == nil {
+		return value
+	}
+	return def
+}
+
+func (s *ConfigSection) GetListOr(key string, def []string) []string {
+	if value, err := s.GetList(key); err == nil {
+		return value
+	}
+	return def
+}
+
+func (c *ConfigManager) GetString(key string) (string, error) { return c.Section("").GetString(key) }
+func (c *ConfigManager) GetInt(key string) (int, error)       { return c.Section("").GetInt(key) }
+func (c *ConfigManager) GetFloat(key string) (float64, error) { return c.Section("").GetFloat(key) }
+func (c *ConfigManager) GetBool(key string) (bool, error)     { return c.Section("").GetBool(key) }
+func (c *ConfigManager) GetDuration(key string) (time.Duration, error) {
+	return c.Section("").GetDuration(key)
+}
+func (c *ConfigManager) GetList(key string) ([]string, error) { return c.Section("").GetList(key) }
+
+func (c *ConfigManager) GetStringOr(key, def string) string {
+	return c.Section("").GetStringOr(key, def)
+}
+func (c *ConfigManager) GetIntOr(key string, def int) int { return c.Section("").GetIntOr(key, def) }
+func (c *ConfigManager) GetFloatOr(key string, def float64) float64 {
+	return c.Section("").GetFloatOr(key, def)
+}
+func (c *ConfigManager) GetBoolOr(key string, def bool) bool {
+	return c.Section("").GetBoolOr(key, def)
+}
+func (c *ConfigManager) GetDurationOr(key string, def time.Duration) time.Duration {
+	return c.Section("").GetDurationOr(key, def)
+}
+func (c *ConfigManager) GetListOr(key string, def []string) []string {
+	return c.Section("").GetListOr(key, def)
+}
+
+func parseIntValue(key, value string) (int, error) {
+	n, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil {
+		return 0, fmt.Errorf("%w: %s = %q is not an integer", ErrInvalidValue, key, value)
+	}
+	return n, nil
+}
+
+func parseFloatValue(key, value string) (float64, error) {
+	f, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %s = %q is not a number", ErrInvalidValue, key, value)
+	}
+	return f, nil
+}
+
+func parseBoolValue(key, value string) (bool, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "1", "t", "true", "yes", "y", "on":
+		return true, nil
+	case "0", "f", "false", "no", "n", "off":
+		return false, nil
+	}
+	return false, fmt.Errorf("%w: %s = %q is not a boolean", ErrInvalidValue, key, value)
+}
+
+func parseDurationValue(key, value string) (time.Duration, error) {
+	d, err := time.ParseDuration(strings.TrimSpace(value))
+	if err != nil {
+		return 0, fmt.Errorf("%w: %s = %q is not a duration", ErrInvalidValue, key, value)
+	}
+	return d, nil
+}
+
+// parseListValue reads a JSON array, as stored for lists from config files,
+// or else a comma-separated value from the environment or a flag.
+func parseListValue(value string) []string {
+	if trimmed := strings.TrimSpace(value); strings.HasPrefix(trimmed, "[") {
+		var decoded []string
+		if err := json.Unmarshal([]byte(trimmed), &decoded); err == nil {
+			return decoded
+		}
+	}
+	items := []string{}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
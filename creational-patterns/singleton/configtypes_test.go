@@ -0,0 +1,109 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func loadTestConfig(t *testing.T, values map[string]string) *ConfigManager {
+	t.Helper()
+	config := NewConfigManager()
+	if err := config.Load(LoadOptions{Defaults: values}); err != nil {
+		t.Fatal(err)
+	}
+	return config
+}
+
+func TestTypedGetters(t *testing.T) {
+	config := loadTestConfig(t, map[string]string{
+		"name": "app", "port": " 8080 ", "ratio": "0.75", "debug": "yes",
+		"timeout": "1m30s", "hosts": "a, b", "bad": "many",
+	})
+
+	if got, err := config.GetString("name"); err != nil || got != "app" {
+		t.Errorf("GetString = %q, %v", got, err)
+	}
+	if got, err := config.GetInt("port"); err != nil || got != 8080 {
+		t.Errorf("GetInt = %d, %v", got, err)
+	}
+	if got, err := config.GetFloat("ratio"); err != nil || got != 0.75 {
+		t.Errorf("GetFloat = %v, %v", got, err)
+	}
+	if got, err := config.GetBool("debug"); err != nil || !got {
+		t.Errorf("GetBool = %v, %v", got, err)
+	}
+	if got, err := config.GetDuration("timeout"); err != nil || got != 90*time.Second {
+		t.Errorf("GetDuration = %v, %v", got, err)
+	}
+	if got, err := config.GetList("hosts"); err != nil || !reflect.DeepEqual(got, []string{"a", "b"}) {
+		t.Errorf("GetList = %q, %v", got, err)
+	}
+
+	if _, err := config.GetInt("missing"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("missing key: got %v, want ErrKeyNotFound", err)
+	}
+	for name, get := range map[string]func(string) error{
+		"GetInt":      func(k string) error { _, err := config.GetInt(k); return err },
+		"GetFloat":    func(k string) error { _, err := config.GetFloat(k); return err },
+		"GetBool":     func(k string) error { _, err := config.GetBool(k); return err },
+		"GetDuration": func(k string) error { _, err := config.GetDuration(k); return err },
+	} {
+		if err := get("bad"); !errors.Is(err, ErrInvalidValue) {
+			t.Errorf("%s(bad): got %v, want ErrInvalidValue", name, err)
+		}
+	}
+}
+
+func TestTypedGettersOrFallBack(t *testing.T) {
+	config := loadTestConfig(t, map[string]string{"port": "8080", "bad": "many"})
+
+	if got := config.GetIntOr("port", 1); got != 8080 {
+		t.Errorf("GetIntOr on a set key = %d", got)
+	}
+	for _, key := range []string{"missing", "bad"} {
+		if got := config.GetIntOr(key, 1); got != 1 {
+			t.Errorf("GetIntOr(%q) = %d, want the default", key, got)
+		}
+		if got := config.GetFloatOr(key, 1.5); got != 1.5 {
+			t.Errorf("GetFloatOr(%q) = %v, want the default", key, got)
+		}
+		if got := config.GetBoolOr(key, true); !got {
+			t.Errorf("GetBoolOr(%q) = false, want the default", key)
+		}
+		if got := config.GetDurationOr(key, time.Second); got != time.Second {
+			t.Errorf("GetDurationOr(%q) = %v, want the default", key, got)
+		}
+	}
+	if got := config.GetStringOr("missing", "def"); got != "def" {
+		t.Errorf("GetStringOr = %q", got)
+	}
+	if got := config.GetListOr("missing", []string{"def"}); !reflect.DeepEqual(got, []string{"def"}) {
+		t.Errorf("GetListOr = %q", got)
+	}
+}
+
+func TestSection(t *testing.T) {
+	config := loadTestConfig(t, map[string]string{
+		"database.host": "db", "database.pool.size": "4", "databases": "x", "port": "80",
+	})
+	database := config.Section("database")
+	if got := database.Keys(); !reflect.DeepEqual(got, []string{"host", "pool.size"}) {
+		t.Errorf("Keys = %q", got)
+	}
+	if got, err := database.Section("pool").GetInt("size"); err != nil || got != 4 {
+		t.Errorf("pool.size = %d, %v", got, err)
+	}
+	if _, err := database.GetString("port"); !errors.Is(err, ErrKeyNotFound) || err.Error() != "config key not found: database.port" {
+		t.Errorf("a key outside the section: got %v", err)
+	}
+
+	// A section reads the live configuration.
+	if err := config.Set("database.host", "db2"); err != nil {
+		t.Fatal(err)
+	}
+	if got := database.GetStringOr("host", ""); got != "db2" {
+		t.Errorf("after Set host = %q", got)
+	}
+}
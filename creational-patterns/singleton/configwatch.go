@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+)
+
+type ChangeKind string
+
+const (
+	KeyAdded    ChangeKind = "added"
+	KeyRemoved  ChangeKind = "removed"
+	KeyModified ChangeKind = "modified"
+)
+
+// ConfigChange carries the real old and new values so subscribers can act
+// on them; String redacts them when Secret is set.
+type ConfigChange struct {
+	Key    string
+	Kind   ChangeKind
+	Old    string
+	New    string
+	Secret bool
+}
+
+func (c ConfigChange) String() string {
+	if c.Secret {
+		c.Old, c.New = Redacted, Redacted
+	}
+	switch c.Kind {
+	case KeyAdded:
+		return fmt.Sprintf("+ %s = %s", c.Key, c.New)
+	case KeyRemoved:
+		return fmt.Sprintf("- %s (was %s)", c.Key, c.Old)
+	default:
+		return fmt.Sprintf("~ %s: %s -> %s", c.Key, c.Old, c.New)
+	}
+}
+
+func diffSettings(old, new map[string]string) []ConfigChange {
+	var changes []ConfigChange
+	for k, v := range new {
+		prev, ok := old[k]
+		switch {
+		case !ok:
+			changes = append(changes, ConfigChange{Key: k, Kind: KeyAdded, New: v})
+		case prev != v:
+			changes = append(changes, ConfigChange{Key: k, Kind: KeyModified, Old: prev, New: v})
+		}
+	}
+	for k, v := range old {
+		if _, ok := new[k]; !ok {
+			changes = append(changes, ConfigChange{Key: k, Kind: KeyRemoved, Old: v})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Key < changes[j].Key })
+	return changes
+}
+
+// Subscribe registers fn to receive the keys changed by each Load, Reload
+// or Set. Callbacks run after the new configuration is visible to readers
+// and after the change's locks are released, so a callback may itself call
+// Set, Load or SetSchema. Change sets arrive one at a time in the order they
+// were made: a change made while callbacks are running, including one made
+// by a callback, is delivered once they return, by the goroutine already
+// delivering.
+func (c *ConfigManager) Subscribe(fn func([]ConfigChange)) (unsubscribe func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	id := c.nextSubID
+	c.nextSubID++
+	c.subscribers[id] = fn
+	return func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		delete(c.subscribers, id)
+	}
+}
+
+// enqueue queues changes for delivery. The caller holds loadMu, which
+// fixes the order of the queue.
+func (c *ConfigManager) enqueue(changes []ConfigChange) {
+	if len(changes) == 0 {
+		return
+	}
+	c.notifyMu.Lock()
+	c.queue = append(c.queue, changes)
+	c.notifyMu.Unlock()
+}
+
+// deliver sends the queued changes to the subscribers unless another call
+// is already doing so.
+func (c *ConfigManager) deliver() {
+	c.notifyMu.Lock()
+	if c.delivering {
+		c.notifyMu.Unlock()
+		return
+	}
+	c.delivering = true
+	c.notifyMu.Unlock()
+	drained := false
+	defer func() {
+		if !drained { // a subscriber panicked
+			c.notifyMu.Lock()
+			c.delivering = false
+			c.notifyMu.Unlock()
+		}
+	}()
+	for {
+		c.notifyMu.Lock()
+		if len(c.queue) == 0 {
+			c.delivering, drained = false, true
+			c.notifyMu.Unlock()
+			return
+		}
+		changes := c.queue[0]
+		c.queue = c.queue[1:]
+		c.notifyMu.Unlock()
+		c.notify(changes)
+	}
+}
+
+func (c *ConfigManager) notify(changes []ConfigChange) {
+	if len(changes) == 0 {
+		return
+	}
+	c.mu.RLock()
+	ids := make([]int, 0, len(c.subscribers))
+	for id := range c.subscribers {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	subscribers := make([]func([]ConfigChange), 0, len(ids))
+	for _, id := range ids {
+		subscribers = append(subscribers, c.subscribers[id])
+	}
+	c.mu.RUnlock()
+	for _, fn := range subscribers {
+		fn(changes)
+	}
+}
+
+// Watch polls the configuration files every interval and reloads when any
+// of them changes. A reload that fails keeps the last good configuration
+// and is reported to onError, which may be nil; the same content is not
+// retried until the files change again. Watch returns when ctx is done.
+func (c *ConfigManager) Watch(ctx context.Context, interval time.Duration, onError func(error)) {
+	c.mu.RLock()
+	last := c.fingerprint
+	c.mu.RUnlock()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		current := fingerprintFiles(c.Options().Files)
+		if current == last {
+			continue
+		}
+		last = current
+		if err := c.Reload(); err != nil && onError != nil {
+			onError(err)
+		}
+	}
+}
+
+func fingerprintFiles(files []string) [sha256.Size]byte {
+	h := sha256.New()
+	for _, path := range files {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Fprintf(h, "%s\x00missing\x00", path)
+			continue
+		}
+		hashFile(h, path, data)
+	}
+	var sum [sha256.Size]byte
+	copy(sum[:], h.Sum(nil))
+	return sum
+}
+
+func hashFile(h io.Writer, path string, data []byte) {
+	fmt.Fprintf(h, "%s\x00%d\x00", path, len(data))
+	h.Write(data)
+}
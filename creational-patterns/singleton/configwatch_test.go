@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeConfig replaces path with a rename, as the README recommends, so
+// the watcher never reads a partial write.
+func writeConfig(t *testing.T, path, content string) {
+	t.Helper()
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWatchDeliversChangesAndKeepsLastGoodConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.json")
+	writeConfig(t, path, `{"log_level": "info", "port": 8080}`)
+	config := NewConfigManager()
+	if err := config.Load(LoadOptions{Files: []string{path}}); err != nil {
+		t.Fatal(err)
+	}
+
+	changes := make(chan []ConfigChange, 10)
+	errs := make(chan error, 10)
+	defer config.Subscribe(func(c []ConfigChange) { changes <- c })()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go config.Watch(ctx, 5*time.Millisecond, func(err error) { errs <- err })
+
+	writeConfig(t, path, `{"log_level": "debug", "port": 8080}`)
+	select {
+	case got := <-changes:
+		want := ConfigChange{Key: "log_level", Kind: KeyModified, Old: "info", New: "debug"}
+		if len(got) != 1 || got[0] != want {
+			t.Errorf("changes = %+v, want [%+v]", got, want)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no change delivered after the file was edited")
+	}
+
+	writeConfig(t, path, `{"log_level": `)
+	select {
+	case <-errs:
+	case <-time.After(2 * time.Second):
+		t.Fatal("the invalid file was not reported")
+	}
+	if got := config.Get("log_level"); got != "debug" {
+		t.Errorf("after an invalid reload log_level = %q, want the last good value", got)
+	}
+	select {
+	case c := <-changes:
+		t.Errorf("an invalid reload delivered %+v", c)
+	default:
+	}
+}
+
+func TestSubscriberCanChangeTheConfig(t *testing.T) {
+	config := NewConfigManager()
+	if err := config.Load(LoadOptions{Defaults: map[string]string{"a": "1"}}); err != nil {
+		t.Fatal(err)
+	}
+	var seen []string
+	config.Subscribe(func(changes []ConfigChange) {
+		for _, c := range changes {
+			seen = append(seen, c.Key+"="+c.New)
+			if c.Key == "a" {
+				if err := config.Set("b", "derived-"+c.New); err != nil {
+					t.Error(err)
+				}
+				if err := config.SetSchema(ConfigSchema{}); err != nil {
+					t.Error(err)
+				}
+			}
+		}
+	})
+
+	done := make(chan error, 1)
+	go func() { done <- config.Set("a", "2") }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Set deadlocked on a subscriber that calls Set")
+	}
+	if got := config.Get("b"); got != "derived-2" {
+		t.Errorf("b = %q, want derived-2", got)
+	}
+	if len(seen) != 2 || seen[0] != "a=2" || seen[1] != "b=derived-2" {
+		t.Errorf("subscriber saw %v, want [a=2 b=derived-2] in order", seen)
+	}
+}
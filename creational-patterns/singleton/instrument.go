@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+type databaseMetrics struct {
+	registry *MetricsRegistry
+	label    string
+	queries  *Counter
+	duration *Histogram
+}
+
+// instrumentMu makes choosing a pool label and registering its series one
+// step, so two databases cannot pick the same label.
+var instrumentMu sync.Mutex
+
+// Instrument exports the database's query counts and latencies and the
+// pool figures shown by GetInfo to m, labelled with the database name:
+// host, port and database, never the credentials. Connection strings that
+// differ only in their credentials have the same name, so a database whose
+// name is already in use in m gets a numbered label, such as
+// "localhost:5432/myapp#2", instead of replacing the other's series.
+func (db *Database) Instrument(m *MetricsRegistry) {
+	instrumentMu.Lock()
+	defer instrumentMu.Unlock()
+	if current := db.metrics.Load(); current != nil && current.registry == m {
+		return
+	}
+	label := db.name
+	for n := 2; m.hasSeries("db_created_timestamp_seconds", Labels{"pool": label}); n++ {
+		label = fmt.Sprintf("%s#%d", db.name, n)
+	}
+	labels := Labels{"pool": label}
+	pool := func(stat func(PoolStats) float64) func() float64 {
+		return func() float64 { return stat(db.pool.Stats()) }
+	}
+	m.GaugeFunc("db_created_timestamp_seconds", "Unix time the database instance was created.", labels,
+		func() float64 { return float64(db.createdAt.UnixNano()) / 1e9 })
+	m.GaugeFunc("db_pool_open_connections", "Connections currently open.", labels, pool(func(s PoolStats) float64 { return float64(s.Open) }))
+	m.GaugeFunc("db_pool_idle_connections", "Open connections waiting in the pool.", labels, pool(func(s PoolStats) float64 { return float64(s.Idle) }))
+	m.GaugeFunc("db_pool_in_use_connections", "Connections currently borrowed.", labels, pool(func(s PoolStats) float64 { return float64(s.InUse) }))
+	m.CounterFunc("db_pool_acquired_total", "Connections handed out by Acquire.", labels, pool(func(s PoolStats) float64 { return float64(s.Acquired) }))
+	m.CounterFunc("db_pool_opened_total", "Connections opened by the driver.", labels, pool(func(s PoolStats) float64 { return float64(s.Opened) }))
+	m.CounterFunc("db_pool_closed_total", "Connections closed.", labels, pool(func(s PoolStats) float64 { return float64(s.Closed) }))
+	m.CounterFunc("db_pool_timeouts_total", "Acquire calls that timed out.", labels, pool(func(s PoolStats) float64 { return float64(s.Timeouts) }))
+	m.CounterFunc("db_pool_health_check_failures_total", "Idle connections that failed their health check.", labels, pool(func(s PoolStats) float64 { return float64(s.HealthFails) }))
+	db.metrics.Store(&databaseMetrics{
+		registry: m,
+		label:    label,
+		queries:  m.Counter("db_queries_total", "Queries run through Database.Query.", "pool", "status"),
+		duration: m.Histogram("db_query_duration_seconds", "Time spent in Database.Query, including waiting for a connection.", nil, "pool"),
+	})
+}
+
+var databaseFuncMetrics = []string{
+	"db_created_timestamp_seconds",
+	"db_pool_open_connections",
+	"db_pool_idle_connections",
+	"db_pool_in_use_connections",
+	"db_pool_acquired_total",
+	"db_pool_opened_total",
+	"db_pool_closed_total",
+	"db_pool_timeouts_total",
+	"db_pool_health_check_failures_total",
+}
+
+// Uninstrument removes the database's series from m, for instances that
+// are closed while the process keeps running.
+func (db *Database) Uninstrument(m *MetricsRegistry) {
+	instrumentMu.Lock()
+	defer instrumentMu.Unlock()
+	metrics := db.metrics.Load()
+	if metrics == nil || metrics.registry != m {
+		return
+	}
+	db.metrics.Store(nil)
+	for _, name := range databaseFuncMetrics {
+		m.RemoveSeries(name, Labels{"pool": metrics.label})
+	}
+	for _, status := range []string{"ok", "error"} {
+		m.RemoveSeries("db_queries_total", Labels{"pool": metrics.label, "status": status})
+	}
+	m.RemoveSeries("db_query_duration_seconds", Labels{"pool": metrics.label})
+}
+
+func (db *Database) observeQuery(start time.Time, err error) {
+	metrics := db.metrics.Load()
+	if metrics == nil {
+		return
+	}
+	status := "ok"
+	if err != nil {
+		status = "error"
+	}
+	metrics.queries.Inc(metrics.label, status)
+	metrics.duration.Observe(time.Since(start).Seconds(), metrics.label)
+}
+
+// Instrument counts the entries the logger writes, by level, and the sink
+// writes that fail. Loggers made with With share the counters.
+func (l *Logger) Instrument(m *MetricsRegistry) {
+	core := l.core
+	m.GaugeFunc("logger_created_timestamp_seconds", "Unix time the logger was created.", nil,
+		func() float64 { return float64(core.createdAt.UnixNano()) / 1e9 })
+	m.GaugeFunc("logger_level", "Minimum level written (0 debug, 1 info, 2 warn, 3 error).", nil,
+		func() float64 { return float64(core.level.Load()) })
+	m.CounterFunc("log_sink_errors_total", "Sink writes that failed.", nil,
+		func() float64 { return float64(core.sinkErrors.Load()) })
+	core.entries.Store(m.Counter("log_entries_total", "Log entries written, by level.", "level"))
+}
+
+func (c *loggerCore) countEntry(level Level) {
+	if entries := c.entries.Load(); entries != nil {
+		entries.Inc(strings.ToLower(level.String()))
+	}
+}
+
+type configMetrics struct {
+	sets    *Counter
+	reloads *Counter
+}
+
+// Instrument counts runtime Set calls and loads, each by result, and
+// exports the number of keys. Keys are not used as labels, so secret key
+// names never reach the metrics.
+func (c *ConfigManager) Instrument(m *MetricsRegistry) {
+	m.GaugeFunc("config_keys", "Configuration keys currently set.", nil, func() float64 {
+		c.mu.RLock()
+		defer c.mu.RUnlock()
+		return float64(len(c.settings))
+	})
+	c.metrics.Store(&configMetrics{
+		sets:    m.Counter("config_sets_total", "ConfigManager.Set calls, by result.", "result"),
+		reloads: m.Counter("config_loads_total", "ConfigManager loads and reloads, by result.", "result"),
+	})
+}
+
+func (c *ConfigManager) countSet(err error) {
+	if metrics := c.metrics.Load(); metrics != nil {
+		metrics.sets.Inc(resultLabel(err))
+	}
+}
+
+func (c *ConfigManager) countLoad(err error) {
+	if metrics := c.metrics.Load(); metrics != nil {
+		metrics.reloads.Inc(resultLabel(err))
+	}
+}
+
+func resultLabel(err error) string {
+	if err != nil {
+		return "rejected"
+	}
+	return "ok"
+}
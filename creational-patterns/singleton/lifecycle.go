@@ -0,0 +1,273 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+var ErrAlreadyStarted = errors.New("lifecycle already started")
+
+// A component may implement any of Starter, Stopper and HealthChecker;
+// the lifecycle manager skips the steps it does not implement.
+type Starter interface {
+	Start(ctx context.Context) error
+}
+
+type Stopper interface {
+	Stop(ctx context.Context) error
+}
+
+type HealthChecker interface {
+	Health(ctx context.Context) error
+}
+
+type lifecycleComponent struct {
+	name      string
+	instance  interface{}
+	dependsOn []string
+}
+
+type ComponentHealth struct {
+	Name    string
+	Healthy bool
+	Checked bool
+	Err     error
+}
+
+type HealthReport struct {
+	Healthy    bool
+	Components []ComponentHealth
+}
+
+func (r HealthReport) String() string {
+	var b strings.Builder
+	status := "healthy"
+	if !r.Healthy {
+		status = "unhealthy"
+	}
+	fmt.Fprintf(&b, "overall: %s", status)
+	for _, c := range r.Components {
+		switch {
+		case !c.Checked:
+			fmt.Fprintf(&b, "\n  %-10s ok (no health check)", c.Name)
+		case c.Healthy:
+			fmt.Fprintf(&b, "\n  %-10s ok", c.Name)
+		default:
+			fmt.Fprintf(&b, "\n  %-10s FAIL: %v", c.Name, c.Err)
+		}
+	}
+	return b.String()
+}
+
+// LifecycleManager starts components after the components they depend on
+// and stops them in the reverse order.
+type LifecycleManager struct {
+	// HealthTimeout bounds each health check.
+	HealthTimeout time.Duration
+	// RollbackTimeout bounds stopping the started components when Start
+	// fails, independently of the context passed to Start.
+	RollbackTimeout time.Duration
+
+	mu         sync.Mutex
+	components []lifecycleComponent
+	started    []lifecycleComponent
+	running    bool
+}
+
+func NewLifecycleManager() *LifecycleManager {
+	return &LifecycleManager{HealthTimeout: 5 * time.Second, RollbackTimeout: 10 * time.Second}
+}
+
+func (m *LifecycleManager) Add(name string, instance interface{}, dependsOn ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.components = append(m.components, lifecycleComponent{name: name, instance: instance, dependsOn: dependsOn})
+}
+
+// Start starts every component in dependency order. If one fails, the
+// components already started are stopped again and the error is returned.
+// The rollback gets its own context bounded by RollbackTimeout, since ctx
+// may be the reason the start failed.
+func (m *LifecycleManager) Start(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.running {
+		return ErrAlreadyStarted
+	}
+	order, err := startOrder(m.components)
+	if err != nil {
+		return err
+	}
+	m.running = true
+	for _, c := range order {
+		if starter, ok := c.instance.(Starter); ok {
+			if err := starter.Start(ctx); err != nil {
+				err = fmt.Errorf("starting %s: %w", c.name, err)
+				return errors.Join(err, m.rollbackLocked(ctx))
+			}
+		}
+		fmt.Printf("[Lifecycle] started %s\n", c.name)
+		m.started = append(m.started, c)
+	}
+	return nil
+}
+
+// Stop stops the started components in reverse start order. Every
+// component is given the chance to stop; the errors are joined.
+func (m *LifecycleManager) Stop(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.stopLocked(ctx)
+}
+
+func (m *LifecycleManager) rollbackLocked(ctx context.Context) error {
+	ctx = context.WithoutCancel(ctx)
+	if m.RollbackTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, m.RollbackTimeout)
+		defer cancel()
+	}
+	return m.stopLocked(ctx)
+}
+
+func (m *LifecycleManager) stopLocked(ctx context.Context) error {
+	var errs []error
+	for i := len(m.started) - 1; i >= 0; i-- {
+		c := m.started[i]
+		if stopper, ok := c.instance.(Stopper); ok {
+			if err := stopper.Stop(ctx); err != nil {
+				errs = append(errs, fmt.Errorf("stopping %s: %w", c.name, err))
+				continue
+			}
+		}
+		fmt.Printf("[Lifecycle] stopped %s\n", c.name)
+	}
+	m.started = nil
+	m.running = false
+	return errors.Join(errs...)
+}
+
+// Run starts the components, waits until ctx is cancelled or the process
+// receives SIGINT or SIGTERM, then stops them, allowing at most
+// stopTimeout for the shutdown.
+func (m *LifecycleManager) Run(ctx context.Context, stopTimeout time.Duration) error {
+	ctx, cancel := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	if err := m.Start(ctx); err != nil {
+		return err
+	}
+	<-ctx.Done()
+	fmt.Println("[Lifecycle] shutting down")
+	stopCtx, stopCancel := context.WithTimeout(context.Background(), stopTimeout)
+	defer stopCancel()
+	return m.Stop(stopCtx)
+}
+
+// Health runs the health check of every component concurrently. The
+// report is healthy only if every check passes. A check that runs longer
+// than HealthTimeout fails with context.DeadlineExceeded, even if it
+// ignores its context.
+func (m *LifecycleManager) Health(ctx context.Context) HealthReport {
+	m.mu.Lock()
+	components := append([]lifecycleComponent(nil), m.components...)
+	m.mu.Unlock()
+
+	results := make([]ComponentHealth, len(components))
+	var wg sync.WaitGroup
+	for i, c := range components {
+		results[i] = ComponentHealth{Name: c.name, Healthy: true}
+		checker, ok := c.instance.(HealthChecker)
+		if !ok {
+			continue
+		}
+		wg.Add(1)
+		go func(i int, checker HealthChecker) {
+			defer wg.Done()
+			err := m.checkHealth(ctx, checker)
+			results[i].Checked = true
+			results[i].Healthy = err == nil
+			results[i].Err = err
+		}(i, checker)
+	}
+	wg.Wait()
+
+	report := HealthReport{Healthy: true, Components: results}
+	for _, r := range results {
+		if !r.Healthy {
+			report.Healthy = false
+		}
+	}
+	return report
+}
+
+func (m *LifecycleManager) checkHealth(ctx context.Context, checker HealthChecker) error {
+	if m.HealthTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, m.HealthTimeout)
+		defer cancel()
+	}
+	result := make(chan error, 1)
+	go func() { result <- checker.Health(ctx) }()
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// startOrder sorts components so that each comes after its dependencies,
+// keeping the order of Add among components that are otherwise unordered.
+func startOrder(components []lifecycleComponent) ([]lifecycleComponent, error) {
+	byName := make(map[string]lifecycleComponent, len(components))
+	for _, c := range components {
+		byName[c.name] = c
+	}
+	for _, c := range components {
+		for _, dep := range c.dependsOn {
+			if _, ok := byName[dep]; !ok {
+				return nil, fmt.Errorf("%w: %s (needed by %s)", ErrServiceNotFound, dep, c.name)
+			}
+		}
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := make(map[string]int, len(components))
+	var order []lifecycleComponent
+	var visit func(c lifecycleComponent, path []string) error
+	visit = func(c lifecycleComponent, path []string) error {
+		switch state[c.name] {
+		case done:
+			return nil
+		case visiting:
+			return fmt.Errorf("%w: %s -> %s", ErrDependencyCycle, strings.Join(path, " -> "), c.name)
+		}
+		state[c.name] = visiting
+		path = append(path, c.name)
+		for _, dep := range c.dependsOn {
+			if err := visit(byName[dep], path); err != nil {
+				return err
+			}
+		}
+		state[c.name] = done
+		order = append(order, c)
+		return nil
+	}
+	for _, c := range components {
+		if err := visit(c, nil); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type fakeComponent struct {
+	name     string
+	events   *[]string
+	startErr error
+	health   func(ctx context.Context) error
+	// stopErr and stopDeadline record the context Stop was called with.
+	stopErr      error
+	stopDeadline bool
+}
+
+func (c *fakeComponent) Start(ctx context.Context) error {
+	if c.startErr != nil {
+		return c.startErr
+	}
+	*c.events = append(*c.events, "start "+c.name)
+	return nil
+}
+
+func (c *fakeComponent) Stop(ctx context.Context) error {
+	c.stopErr = ctx.Err()
+	_, c.stopDeadline = ctx.Deadline()
+	*c.events = append(*c.events, "stop "+c.name)
+	return nil
+}
+
+func (c *fakeComponent) Health(ctx context.Context) error {
+	if c.health == nil {
+		return nil
+	}
+	return c.health(ctx)
+}
+
+func TestLifecycleStartsInDependencyOrder(t *testing.T) {
+	var events []string
+	m := NewLifecycleManager()
+	m.Add("database", &fakeComponent{name: "database", events: &events}, "config", "logger")
+	m.Add("logger", &fakeComponent{name: "logger", events: &events}, "config")
+	m.Add("config", &fakeComponent{name: "config", events: &events})
+	m.Add("plain", struct{}{})
+
+	if err := m.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Start(context.Background()); !errors.Is(err, ErrAlreadyStarted) {
+		t.Errorf("second Start: got %v, want ErrAlreadyStarted", err)
+	}
+	if err := m.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"start config", "start logger", "start database", "stop database", "stop logger", "stop config"}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("events = %v, want %v", events, want)
+	}
+}
+
+func TestLifecycleRollsBackAFailedStart(t *testing.T) {
+	var events []string
+	config := &fakeComponent{name: "config", events: &events}
+	m := NewLifecycleManager()
+	m.Add("config", config)
+	m.Add("logger", &fakeComponent{name: "logger", events: &events}, "config")
+	m.Add("database", &fakeComponent{name: "database", events: &events, startErr: context.Canceled}, "logger")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := m.Start(ctx)
+	if !errors.Is(err, context.Canceled) || err.Error() != "starting database: context canceled" {
+		t.Fatalf("got %v", err)
+	}
+	want := []string{"start config", "start logger", "stop logger", "stop config"}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("events = %v, want %v", events, want)
+	}
+	if config.stopErr != nil || !config.stopDeadline {
+		t.Errorf("the rollback context: err %v, deadline %v; want a live context with a deadline", config.stopErr, config.stopDeadline)
+	}
+
+	// A failed start can be retried.
+	if err := m.Start(context.Background()); !errors.Is(err, context.Canceled) {
+		t.Errorf("retry: got %v", err)
+	}
+}
+
+func TestLifecycleReportsBadDependencies(t *testing.T) {
+	var events []string
+	missing := NewLifecycleManager()
+	missing.Add("logger", &fakeComponent{name: "logger", events: &events}, "config")
+	err := missing.Start(context.Background())
+	if !errors.Is(err, ErrServiceNotFound) || err.Error() != "service not registered: config (needed by logger)" {
+		t.Errorf("missing dependency: got %v", err)
+	}
+
+	cycle := NewLifecycleManager()
+	cycle.Add("config", &fakeComponent{name: "config", events: &events}, "logger")
+	cycle.Add("logger", &fakeComponent{name: "logger", events: &events}, "config")
+	err = cycle.Start(context.Background())
+	if !errors.Is(err, ErrDependencyCycle) || err.Error() != "dependency cycle: config -> logger -> config" {
+		t.Errorf("cycle: got %v", err)
+	}
+	if len(events) != 0 {
+		t.Errorf("components started despite the errors: %v", events)
+	}
+}
+
+func TestLifecycleHealth(t *testing.T) {
+	var events []string
+	failing := errors.New("disk full")
+	m := NewLifecycleManager()
+	m.HealthTimeout = 20 * time.Millisecond
+	m.Add("config", struct{}{})
+	m.Add("logger", &fakeComponent{name: "logger", events: &events})
+	m.Add("database", &fakeComponent{name: "database", events: &events, health: func(ctx context.Context) error { return failing }})
+	m.Add("cache", &fakeComponent{name: "cache", events: &events, health: func(ctx context.Context) error {
+		time.Sleep(time.Second) // ignores its context
+		return nil
+	}})
+
+	start := time.Now()
+	report := m.Health(context.Background())
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Health took %s despite the per-check timeout", elapsed)
+	}
+	if report.Healthy {
+		t.Error("report is healthy with failing checks")
+	}
+	want := []ComponentHealth{
+		{Name: "config", Healthy: true},
+		{Name: "logger", Healthy: true, Checked: true},
+		{Name: "database", Checked: true, Err: failing},
+		{Name: "cache", Checked: true, Err: context.DeadlineExceeded},
+	}
+	if !reflect.DeepEqual(report.Components, want) {
+		t.Errorf("components = %+v, want %+v", report.Components, want)
+	}
+
+	healthy := NewLifecycleManager()
+	healthy.Add("logger", &fakeComponent{name: "logger", events: &events})
+	if report := healthy.Health(context.Background()); !report.Healthy {
+		t.Errorf("got %v", report)
+	}
+}
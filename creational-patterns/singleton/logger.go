@@ -0,0 +1,266 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrLoggerClosed is reported for entries logged after Close or Stop.
+var ErrLoggerClosed = errors.New("logger is closed")
+
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var levelNames = map[Level]string{
+	LevelDebug: "DEBUG",
+	LevelInfo:  "INFO",
+	LevelWarn:  "WARN",
+	LevelError: "ERROR",
+}
+
+func (l Level) String() string {
+	if name, ok := levelNames[l]; ok {
+		return name
+	}
+	return fmt.Sprintf("LEVEL(%d)", int(l))
+}
+
+func ParseLevel(name string) (Level, error) {
+	for level, n := range levelNames {
+		if strings.EqualFold(n, name) {
+			return level, nil
+		}
+	}
+	if strings.EqualFold(name, "WARNING") {
+		return LevelWarn, nil
+	}
+	return LevelInfo, fmt.Errorf("unknown log level %q", name)
+}
+
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+type Entry struct {
+	Seq     int64
+	Time    time.Time
+	Level   Level
+	Message string
+	Fields  []Field
+}
+
+type loggerCore struct {
+	mu        sync.Mutex
+	level     atomic.Int32
+	formatter Formatter
+	sinks     []Sink
+	closed    bool
+	createdAt time.Time
+	logCount  atomic.Int64
+	dropped   atomic.Int64
+	// sinkErrors counts failed sink writes; lastSinkErr is the last one
+	// reported on stderr.
+	sinkErrors  atomic.Int64
+	lastSinkErr string
+	now         func() time.Time
+	entries     atomic.Pointer[Counter]
+}
+
+type Logger struct {
+	core   *loggerCore
+	fields []Field
+}
+
+func NewLogger(level Level, formatter Formatter, sinks ...Sink) *Logger {
+	core := &loggerCore{
+		formatter: formatter,
+		sinks:     sinks,
+		createdAt: time.Now(),
+		now:       time.Now,
+	}
+	core.level.Store(int32(level))
+	return &Logger{core: core}
+}
+
+// With returns a logger that adds keyvals to every entry. It shares level,
+// formatter, sinks and counters with its parent.
+func (l *Logger) With(keyvals ...interface{}) *Logger {
+	fields := make([]Field, 0, len(l.fields)+len(keyvals)/2)
+	fields = append(fields, l.fields...)
+	fields = append(fields, toFields(keyvals)...)
+	return &Logger{core: l.core, fields: fields}
+}
+
+func (l *Logger) SetLevel(level Level) {
+	l.core.level.Store(int32(level))
+}
+
+func (l *Logger) Level() Level {
+	return Level(l.core.level.Load())
+}
+
+func (l *Logger) Enabled(level Level) bool {
+	return level >= l.Level()
+}
+
+func (l *Logger) SetFormatter(formatter Formatter) {
+	l.core.mu.Lock()
+	defer l.core.mu.Unlock()
+	l.core.formatter = formatter
+}
+
+// SetSinks replaces the sinks. It does not reopen a closed logger.
+func (l *Logger) SetSinks(sinks ...Sink) {
+	l.core.mu.Lock()
+	defer l.core.mu.Unlock()
+	l.core.sinks = sinks
+}
+
+func (l *Logger) Log(level Level, message string, keyvals ...interface{}) {
+	if !l.Enabled(level) {
+		return
+	}
+	fields := l.fields
+	if len(keyvals) > 0 {
+		fields = append(append([]Field(nil), l.fields...), toFields(keyvals)...)
+	}
+
+	c := l.core
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		// The sinks are gone, so the first dropped entry is reported on
+		// stderr and the rest are only counted.
+		if c.dropped.Add(1) == 1 {
+			fmt.Fprintf(os.Stderr, "[logger] %v: dropping %s %q and later entries\n", ErrLoggerClosed, level, message)
+		}
+		return
+	}
+	entry := Entry{
+		Seq:     c.logCount.Add(1),
+		Time:    c.now(),
+		Level:   level,
+		Message: message,
+		Fields:  fields,
+	}
+	line, err := c.formatter.Format(entry)
+	if err != nil {
+		line = []byte(fmt.Sprintf("[logger] cannot format entry: %v\n", err))
+	}
+	for _, sink := range c.sinks {
+		if err := sink.Write(line); err != nil {
+			c.sinkFailed(err)
+		}
+	}
+	c.countEntry(level)
+}
+
+// sinkFailed counts a failed write and reports it on stderr, unless it
+// repeats the error reported last. The caller holds c.mu.
+func (c *loggerCore) sinkFailed(err error) {
+	c.sinkErrors.Add(1)
+	if msg := err.Error(); msg != c.lastSinkErr {
+		c.lastSinkErr = msg
+		fmt.Fprintf(os.Stderr, "[logger] sink write failed: %v\n", err)
+	}
+}
+
+func (l *Logger) Debug(message string, keyvals ...interface{}) {
+	l.Log(LevelDebug, message, keyvals...)
+}
+
+func (l *Logger) Info(message string, keyvals ...interface{}) {
+	l.Log(LevelInfo, message, keyvals...)
+}
+
+func (l *Logger) Warn(message string, keyvals ...interface{}) {
+	l.Log(LevelWarn, message, keyvals...)
+}
+
+func (l *Logger) Error(message string, keyvals ...interface{}) {
+	l.Log(LevelError, message, keyvals...)
+}
+
+func (l *Logger) Sync() error {
+	l.core.mu.Lock()
+	defer l.core.mu.Unlock()
+	var errs []string
+	for _, sink := range l.core.sinks {
+		if err := sink.Sync(); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("syncing log sinks: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// Close flushes and closes every sink. Entries logged afterwards are not
+// written or counted as logs: the first is reported on stderr with
+// ErrLoggerClosed and Dropped counts them all. Closing again does nothing.
+func (l *Logger) Close() error {
+	syncErr := l.Sync()
+	l.core.mu.Lock()
+	sinks := l.core.sinks
+	l.core.sinks = nil
+	l.core.closed = true
+	l.core.mu.Unlock()
+	errs := []error{syncErr}
+	for _, sink := range sinks {
+		errs = append(errs, sink.Close())
+	}
+	return errors.Join(errs...)
+}
+
+func (l *Logger) Stop(ctx context.Context) error {
+	return l.Close()
+}
+
+// Dropped returns the number of entries logged after Close.
+func (l *Logger) Dropped() int64 {
+	return l.core.dropped.Load()
+}
+
+// SinkErrors returns the number of sink writes that failed.
+func (l *Logger) SinkErrors() int64 {
+	return l.core.sinkErrors.Load()
+}
+
+func (l *Logger) GetInfo() string {
+	info := fmt.Sprintf("Logger instance created at %s with %d logs (level %s)",
+		l.core.createdAt.Format("15:04:05"), l.core.logCount.Load(), l.Level())
+	if dropped := l.Dropped(); dropped > 0 {
+		info += fmt.Sprintf(", %d dropped after close", dropped)
+	}
+	if failed := l.SinkErrors(); failed > 0 {
+		info += fmt.Sprintf(", %d failed sink writes", failed)
+	}
+	return info
+}
+
+func toFields(keyvals []interface{}) []Field {
+	fields := make([]Field, 0, (len(keyvals)+1)/2)
+	for i := 0; i < len(keyvals); i += 2 {
+		key := fmt.Sprint(keyvals[i])
+		if i+1 == len(keyvals) {
+			fields = append(fields, Field{Key: "!BADKEY", Value: keyvals[i]})
+			break
+		}
+		fields = append(fields, Field{Key: key, Value: keyvals[i+1]})
+	}
+	return fields
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestLogger(level Level, formatter Formatter) (*Logger, *MemorySink) {
+	memory := NewMemorySink()
+	logger := NewLogger(level, formatter, memory)
+	logger.core.now = func() time.Time { return time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC) }
+	return logger, memory
+}
+
+func TestLoggerFiltersByLevel(t *testing.T) {
+	logger, memory := newTestLogger(LevelWarn, TextFormatter{})
+	logger.Debug("debug")
+	logger.Info("info")
+	logger.Warn("warn")
+	logger.Error("error")
+	if lines := memory.Lines(); len(lines) != 2 || !strings.Contains(lines[0], "warn") || !strings.Contains(lines[1], "error") {
+		t.Errorf("at WARN got %q", lines)
+	}
+	logger.SetLevel(LevelDebug)
+	logger.Debug("debug")
+	if lines := memory.Lines(); len(lines) != 3 {
+		t.Errorf("after SetLevel(DEBUG) got %d lines, want 3", len(lines))
+	}
+}
+
+func TestTextFormatter(t *testing.T) {
+	logger, memory := newTestLogger(LevelInfo, TextFormatter{})
+	logger.Info("Slow query", "user", "alice", "query", "SELECT 1", "dangling")
+	want := `[09:30:00] [INFO] #1: Slow query user=alice query="SELECT 1" !BADKEY=dangling`
+	if lines := memory.Lines(); len(lines) != 1 || lines[0] != want {
+		t.Errorf("got %q, want %q", lines, want)
+	}
+}
+
+func TestJSONFormatterAndWithFields(t *testing.T) {
+	logger, memory := newTestLogger(LevelInfo, JSONFormatter{})
+	request := logger.With("request_id", "req-42")
+	request.With("user", "alice").Error("Payment failed", "amount", 42.5, "error", errors.New("card declined"))
+	request.Info("Done")
+	logger.Info("Unrelated")
+
+	lines := memory.Lines()
+	if len(lines) != 3 {
+		t.Fatalf("got %d lines, want 3", len(lines))
+	}
+	var entry map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &entry); err != nil {
+		t.Fatalf("invalid JSON %q: %v", lines[0], err)
+	}
+	want := map[string]interface{}{
+		"time": "2024-03-01T09:30:00.000Z", "level": "ERROR", "seq": 1.0, "msg": "Payment failed",
+		"request_id": "req-42", "user": "alice", "amount": 42.5, "error": "card declined",
+	}
+	for k, v := range want {
+		if entry[k] != v {
+			t.Errorf("%s = %v, want %v", k, entry[k], v)
+		}
+	}
+	if !strings.Contains(lines[1], `"request_id":"req-42"`) || strings.Contains(lines[1], "alice") {
+		t.Errorf("With fields leaked between loggers: %s", lines[1])
+	}
+	if strings.Contains(lines[2], "request_id") {
+		t.Errorf("the parent logger got its child's fields: %s", lines[2])
+	}
+}
+
+func TestRotatingFileSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	sink, err := NewRotatingFileSink(path, 20, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+	for _, line := range []string{"first line 1\n", "second line\n", "third line\n", "fourth line\n"} {
+		if err := sink.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, want := range map[string]string{path: "fourth line\n", path + ".1": "third line\n", path + ".2": "second line\n"} {
+		if data, _ := os.ReadFile(name); string(data) != want {
+			t.Errorf("%s = %q, want %q", filepath.Base(name), data, want)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Error("more backups kept than maxBackups")
+	}
+}
+
+func TestRotatingFileSinkSurvivesAFailedRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	sink, err := NewRotatingFileSink(path, 10, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+	// A non-empty directory where the backup should go makes the rename fail.
+	os.MkdirAll(filepath.Join(path+".1", "blocker"), 0o755)
+
+	logger := NewLogger(LevelInfo, TextFormatter{}, sink)
+	logger.Info("first entry")
+	logger.Info("second entry")
+	if got := logger.SinkErrors(); got != 1 {
+		t.Errorf("SinkErrors = %d, want 1 for the failed rotation", got)
+	}
+	data, _ := os.ReadFile(path)
+	if !strings.Contains(string(data), "first entry") || !strings.Contains(string(data), "second entry") {
+		t.Fatalf("entries lost after a failed rotation: %q", data)
+	}
+
+	os.RemoveAll(path + ".1")
+	logger.Info("third entry")
+	if got := logger.SinkErrors(); got != 1 {
+		t.Errorf("SinkErrors = %d after a successful rotation, want still 1", got)
+	}
+	if data, _ := os.ReadFile(path); !strings.Contains(string(data), "third entry") || strings.Contains(string(data), "first entry") {
+		t.Errorf("rotation did not recover: %s = %q", filepath.Base(path), data)
+	}
+}
+
+func TestLoggerDropsEntriesAfterClose(t *testing.T) {
+	memory := NewMemorySink()
+	logger := NewLogger(LevelInfo, TextFormatter{}, memory)
+	logger.Info("before")
+	if err := logger.Close(); err != nil {
+		t.Fatal(err)
+	}
+	logger.Info("after")
+	logger.With("k", "v").Error("after")
+	logger.SetSinks(memory)
+	logger.Info("after SetSinks")
+
+	if lines := memory.Lines(); len(lines) != 1 {
+		t.Errorf("sink got %d lines, want only the one logged before Close", len(lines))
+	}
+	if got := logger.Dropped(); got != 3 {
+		t.Errorf("Dropped = %d, want 3", got)
+	}
+	if err := logger.Close(); err != nil {
+		t.Errorf("second Close: %v", err)
+	}
+}
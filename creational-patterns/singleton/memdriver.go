@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// MemoryDriver is an in-memory stand-in for a real database driver. It
+// understands "SELECT * FROM <table>" and nothing else.
+type MemoryDriver struct {
+	mu         sync.RWMutex
+	tables     map[string]Rows
+	nextID     atomic.Int64
+	generation atomic.Int64
+}
+
+func NewMemoryDriver() *MemoryDriver {
+	return &MemoryDriver{tables: make(map[string]Rows)}
+}
+
+func (d *MemoryDriver) AddTable(name string, rows Rows) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.tables[strings.ToLower(name)] = rows
+}
+
+// Restart simulates a database restart: every connection opened so far
+// fails its next Ping or Query with ErrBadConn.
+func (d *MemoryDriver) Restart() {
+	d.generation.Add(1)
+}
+
+func (d *MemoryDriver) Open(dsn string) (Conn, error) {
+	return &memoryConn{driver: d, id: d.nextID.Add(1), dsn: dsn, generation: d.generation.Load()}, nil
+}
+
+type memoryConn struct {
+	driver     *MemoryDriver
+	id         int64
+	dsn        string
+	generation int64
+	closed     atomic.Bool
+}
+
+func (c *memoryConn) broken() bool {
+	return c.closed.Load() || c.generation != c.driver.generation.Load()
+}
+
+func (c *memoryConn) Query(query string) (Rows, error) {
+	if c.broken() {
+		return nil, ErrBadConn
+	}
+	fields := strings.Fields(strings.ToLower(query))
+	if len(fields) != 4 || fields[0] != "select" || fields[1] != "*" || fields[2] != "from" {
+		return nil, fmt.Errorf("memory driver: unsupported query %q", query)
+	}
+	c.driver.mu.RLock()
+	defer c.driver.mu.RUnlock()
+	return append(Rows(nil), c.driver.tables[fields[3]]...), nil
+}
+
+func (c *memoryConn) Ping() error {
+	if c.broken() {
+		return ErrBadConn
+	}
+	return nil
+}
+
+func (c *memoryConn) Close() error {
+	c.closed.Store(true)
+	return nil
+}
@@ -0,0 +1,356 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+type MetricKind string
+
+const (
+	KindCounter   MetricKind = "counter"
+	KindGauge     MetricKind = "gauge"
+	KindHistogram MetricKind = "histogram"
+)
+
+// DefaultBuckets suit request latencies measured in seconds.
+var DefaultBuckets = []float64{0.0005, 0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5}
+
+// Labels names the series of a function metric: {"pool": "main"}.
+type Labels map[string]string
+
+var (
+	metricNameRE = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+	labelNameRE  = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+)
+
+type metricSeries struct {
+	labels []string
+	value  float64
+	counts []uint64
+	count  uint64
+	fn     func() float64
+}
+
+type metricFamily struct {
+	name       string
+	help       string
+	kind       MetricKind
+	labelNames []string
+	buckets    []float64
+
+	mu     sync.Mutex
+	series map[string]*metricSeries
+}
+
+// MetricsRegistry holds counters, gauges and histograms and renders them
+// in the Prometheus text exposition format. Defining a metric twice with
+// the same kind and labels returns the existing one. Invalid names and
+// conflicting definitions are programming errors and panic, as
+// regexp.MustCompile does.
+type MetricsRegistry struct {
+	mu       sync.RWMutex
+	families map[string]*metricFamily
+}
+
+func NewMetricsRegistry() *MetricsRegistry {
+	return &MetricsRegistry{families: make(map[string]*metricFamily)}
+}
+
+func (r *MetricsRegistry) family(name, help string, kind MetricKind, buckets []float64, labelNames []string) *metricFamily {
+	if !metricNameRE.MatchString(name) {
+		panic(fmt.Sprintf("metrics: invalid metric name %q", name))
+	}
+	for _, l := range labelNames {
+		if !labelNameRE.MatchString(l) || l == "le" {
+			panic(fmt.Sprintf("metrics: invalid label name %q on %s", l, name))
+		}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if f, ok := r.families[name]; ok {
+		if f.kind != kind || strings.Join(f.labelNames, ",") != strings.Join(labelNames, ",") {
+			panic(fmt.Sprintf("metrics: %s already registered as %s with labels %v", name, f.kind, f.labelNames))
+		}
+		return f
+	}
+	f := &metricFamily{
+		name:       name,
+		help:       help,
+		kind:       kind,
+		labelNames: append([]string(nil), labelNames...),
+		buckets:    buckets,
+		series:     make(map[string]*metricSeries),
+	}
+	r.families[name] = f
+	return f
+}
+
+func (r *MetricsRegistry) Counter(name, help string, labelNames ...string) *Counter {
+	return &Counter{r.family(name, help, KindCounter, nil, labelNames)}
+}
+
+func (r *MetricsRegistry) Gauge(name, help string, labelNames ...string) *Gauge {
+	return &Gauge{r.family(name, help, KindGauge, nil, labelNames)}
+}
+
+// Histogram counts observations into cumulative buckets with the given
+// upper bounds; nil means DefaultBuckets.
+func (r *MetricsRegistry) Histogram(name, help string, buckets []float64, labelNames ...string) *Histogram {
+	if buckets == nil {
+		buckets = DefaultBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	return &Histogram{r.family(name, help, KindHistogram, buckets, labelNames)}
+}
+
+// GaugeFunc exports the value fn returns at each scrape, which suits
+// figures that are already tracked elsewhere, such as pool statistics.
+// Registering the same labels again replaces fn.
+func (r *MetricsRegistry) GaugeFunc(name, help string, labels Labels, fn func() float64) {
+	r.funcSeries(name, help, KindGauge, labels, fn)
+}
+
+// CounterFunc is GaugeFunc for values that only increase.
+func (r *MetricsRegistry) CounterFunc(name, help string, labels Labels, fn func() float64) {
+	r.funcSeries(name, help, KindCounter, labels, fn)
+}
+
+func (r *MetricsRegistry) funcSeries(name, help string, kind MetricKind, labels Labels, fn func() float64) {
+	names := make([]string, 0, len(labels))
+	for k := range labels {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	values := make([]string, len(names))
+	for i, k := range names {
+		values[i] = labels[k]
+	}
+	f := r.family(name, help, kind, nil, names)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.series[seriesKey(values)] = &metricSeries{labels: values, fn: fn}
+}
+
+// RemoveSeries drops one labelled series, for example the metrics of a
+// connection pool that has been closed.
+func (r *MetricsRegistry) RemoveSeries(name string, labels Labels) {
+	r.mu.RLock()
+	f, ok := r.families[name]
+	r.mu.RUnlock()
+	if !ok {
+		return
+	}
+	values := make([]string, len(f.labelNames))
+	for i, k := range f.labelNames {
+		values[i] = labels[k]
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.series, seriesKey(values))
+}
+
+// hasSeries reports whether the series with the given labels exists.
+func (r *MetricsRegistry) hasSeries(name string, labels Labels) bool {
+	r.mu.RLock()
+	f, ok := r.families[name]
+	r.mu.RUnlock()
+	if !ok {
+		return false
+	}
+	values := make([]string, len(f.labelNames))
+	for i, k := range f.labelNames {
+		values[i] = labels[k]
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	_, ok = f.series[seriesKey(values)]
+	return ok
+}
+
+func seriesKey(values []string) string {
+	return strings.Join(values, "\xff")
+}
+
+// lookup returns the series for labelValues if it exists. The caller
+// holds f.mu.
+func (f *metricFamily) lookup(labelValues []string) (*metricSeries, bool) {
+	if len(labelValues) != len(f.labelNames) {
+		panic(fmt.Sprintf("metrics: %s takes %d label values (%v), got %d", f.name, len(f.labelNames), f.labelNames, len(labelValues)))
+	}
+	s, ok := f.series[seriesKey(labelValues)]
+	return s, ok
+}
+
+// get returns the series for labelValues, creating it if needed. The
+// caller holds f.mu.
+func (f *metricFamily) get(labelValues []string) *metricSeries {
+	s, ok := f.lookup(labelValues)
+	if !ok {
+		s = &metricSeries{labels: append([]string(nil), labelValues...)}
+		if f.kind == KindHistogram {
+			s.counts = make([]uint64, len(f.buckets))
+		}
+		f.series[seriesKey(labelValues)] = s
+	}
+	return s
+}
+
+type Counter struct{ f *metricFamily }
+
+func (c *Counter) Inc(labelValues ...string) { c.Add(1, labelValues...) }
+
+func (c *Counter) Add(delta float64, labelValues ...string) {
+	if delta < 0 {
+		panic(fmt.Sprintf("metrics: counter %s cannot decrease", c.f.name))
+	}
+	c.f.mu.Lock()
+	defer c.f.mu.Unlock()
+	c.f.get(labelValues).value += delta
+}
+
+// Value returns the count for labelValues, or 0 for a series that has not
+// been counted yet. Reading does not create the series.
+func (c *Counter) Value(labelValues ...string) float64 {
+	c.f.mu.Lock()
+	defer c.f.mu.Unlock()
+	if s, ok := c.f.lookup(labelValues); ok {
+		return s.value
+	}
+	return 0
+}
+
+type Gauge struct{ f *metricFamily }
+
+func (g *Gauge) Set(value float64, labelValues ...string) {
+	g.f.mu.Lock()
+	defer g.f.mu.Unlock()
+	g.f.get(labelValues).value = value
+}
+
+func (g *Gauge) Add(delta float64, labelValues ...string) {
+	g.f.mu.Lock()
+	defer g.f.mu.Unlock()
+	g.f.get(labelValues).value += delta
+}
+
+func (g *Gauge) Inc(labelValues ...string) { g.Add(1, labelValues...) }
+func (g *Gauge) Dec(labelValues ...string) { g.Add(-1, labelValues...) }
+
+type Histogram struct{ f *metricFamily }
+
+func (h *Histogram) Observe(value float64, labelValues ...string) {
+	h.f.mu.Lock()
+	defer h.f.mu.Unlock()
+	s := h.f.get(labelValues)
+	for i, bound := range h.f.buckets {
+		if value <= bound {
+			s.counts[i]++
+		}
+	}
+	s.count++
+	s.value += value
+}
+
+// WriteTo renders every metric in the Prometheus text format, families
+// sorted by name and series by label values.
+func (r *MetricsRegistry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.RLock()
+	families := make([]*metricFamily, 0, len(r.families))
+	for _, f := range r.families {
+		families = append(families, f)
+	}
+	r.mu.RUnlock()
+	sort.Slice(families, func(i, j int) bool { return families[i].name < families[j].name })
+
+	var b strings.Builder
+	for _, f := range families {
+		f.write(&b)
+	}
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+func (f *metricFamily) write(b *strings.Builder) {
+	f.mu.Lock()
+	series := make([]metricSeries, 0, len(f.series))
+	for _, s := range f.series {
+		copied := *s
+		copied.counts = append([]uint64(nil), s.counts...)
+		series = append(series, copied)
+	}
+	f.mu.Unlock()
+	if len(series) == 0 {
+		return
+	}
+	sort.Slice(series, func(i, j int) bool { return seriesKey(series[i].labels) < seriesKey(series[j].labels) })
+
+	fmt.Fprintf(b, "# HELP %s %s\n", f.name, escapeHelp(f.help))
+	fmt.Fprintf(b, "# TYPE %s %s\n", f.name, f.kind)
+	for _, s := range series {
+		if f.kind != KindHistogram {
+			value := s.value
+			if s.fn != nil {
+				value = s.fn()
+			}
+			fmt.Fprintf(b, "%s%s %s\n", f.name, formatLabels(f.labelNames, s.labels, "", 0), formatFloat(value))
+			continue
+		}
+		for i, bound := range f.buckets {
+			fmt.Fprintf(b, "%s_bucket%s %d\n", f.name, formatLabels(f.labelNames, s.labels, "le", bound), s.counts[i])
+		}
+		fmt.Fprintf(b, "%s_bucket%s %d\n", f.name, formatLabels(f.labelNames, s.labels, "le", math.Inf(1)), s.count)
+		fmt.Fprintf(b, "%s_sum%s %s\n", f.name, formatLabels(f.labelNames, s.labels, "", 0), formatFloat(s.value))
+		fmt.Fprintf(b, "%s_count%s %d\n", f.name, formatLabels(f.labelNames, s.labels, "", 0), s.count)
+	}
+}
+
+func formatLabels(names, values []string, extraName string, extraValue float64) string {
+	if len(names) == 0 && extraName == "" {
+		return ""
+	}
+	pairs := make([]string, 0, len(names)+1)
+	for i, name := range names {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, name, escapeLabelValue(values[i])))
+	}
+	if extraName != "" {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, extraName, formatFloat(extraValue)))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string       { return helpEscaper.Replace(s) }
+func escapeLabelValue(s string) string { return labelEscaper.Replace(s) }
+
+// Handler serves the metrics for a Prometheus scrape.
+func (r *MetricsRegistry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.WriteTo(w)
+	})
+}
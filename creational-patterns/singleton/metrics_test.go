@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestCounterValueDoesNotCreateSeries(t *testing.T) {
+	m := NewMetricsRegistry()
+	requests := m.Counter("requests_total", "Requests.", "route")
+	requests.Inc("/a")
+	if got := requests.Value("/missing"); got != 0 {
+		t.Errorf("Value of an unseen series = %v, want 0", got)
+	}
+	if got := requests.Value("/a"); got != 1 {
+		t.Errorf("Value(/a) = %v, want 1", got)
+	}
+	var out bytes.Buffer
+	m.WriteTo(&out)
+	if strings.Contains(out.String(), "/missing") {
+		t.Errorf("reading a value exported a new series:\n%s", out.String())
+	}
+}
+
+func TestDSNName(t *testing.T) {
+	for dsn, want := range map[string]string{
+		"localhost:5432/myapp":                                   "localhost:5432/myapp",
+		"postgres://app:s3cret@db:5432/orders?sslmode=disable":   "db:5432/orders",
+		"app:p@ss@word@db:5432/orders":                           "db:5432/orders",
+		"host=db port=5432 user=app password=s3cret dbname=shop": "db:5432/shop",
+	} {
+		if got := dsnName(dsn); got != want {
+			t.Errorf("dsnName(%q) = %q, want %q", dsn, got, want)
+		}
+	}
+}
+
+func TestDatabaseMetricsLeaveOutCredentials(t *testing.T) {
+	m := NewMetricsRegistry()
+	db := newDatabase("postgres://app:s3cret@db:5432/orders")
+	defer db.Close()
+	db.Instrument(m)
+	db.Query("SELECT * FROM users")
+
+	var out bytes.Buffer
+	m.WriteTo(&out)
+	if strings.Contains(out.String(), "s3cret") || !strings.Contains(out.String(), `pool="db:5432/orders"`) {
+		t.Errorf("metrics are not labelled with the credential-free name:\n%s", out.String())
+	}
+}
+
+func TestDatabasesWithTheSameNameGetDistinctLabels(t *testing.T) {
+	m := NewMetricsRegistry()
+	first := newDatabase("postgres://alice:a@db:5432/orders")
+	second := newDatabase("postgres://bob:b@db:5432/orders")
+	defer first.Close()
+	defer second.Close()
+	first.Instrument(m)
+	second.Instrument(m)
+	second.Instrument(m)
+	first.Query("SELECT * FROM users")
+	second.Query("SELECT * FROM users")
+	second.Query("SELECT * FROM users")
+
+	queries := m.Counter("db_queries_total", "Queries run through Database.Query.", "pool", "status")
+	if a, b := queries.Value("db:5432/orders", "ok"), queries.Value("db:5432/orders#2", "ok"); a != 1 || b != 2 {
+		t.Errorf("queries = %v and %v, want 1 and 2", a, b)
+	}
+	if !m.hasSeries("db_pool_open_connections", Labels{"pool": "db:5432/orders#2"}) ||
+		m.hasSeries("db_pool_open_connections", Labels{"pool": "db:5432/orders#3"}) {
+		t.Error("instrumenting twice added another label")
+	}
+
+	second.Uninstrument(m)
+	if !m.hasSeries("db_pool_open_connections", Labels{"pool": "db:5432/orders"}) {
+		t.Error("Uninstrument removed the other database's series")
+	}
+	if m.hasSeries("db_pool_open_connections", Labels{"pool": "db:5432/orders#2"}) {
+		t.Error("Uninstrument left its own series behind")
+	}
+}
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+var ErrMultitonClosed = errors.New("multiton is closed")
+
+type multitonEntry[V any] struct {
+	ready     chan struct{}
+	value     V
+	err       error
+	createdAt time.Time
+	lastUsed  time.Time
+	hits      int64
+	// refs counts Acquire calls not yet released. A retired entry has left
+	// the map and is closed, and done closed, once refs drops to zero.
+	refs    int
+	retired bool
+	done    chan struct{}
+}
+
+type InstanceStats[K comparable] struct {
+	Key       K
+	CreatedAt time.Time
+	LastUsed  time.Time
+	Hits      int64
+	Held      int
+}
+
+// Multiton keeps exactly one instance per key, created lazily by create.
+// Concurrent first calls for the same key wait for a single construction;
+// calls for other keys are not blocked by it. A failed construction is not
+// cached, so the next call retries.
+//
+// An instance obtained with Acquire is held until its release function is
+// called: EvictIdle leaves it alone, and Remove and Close only detach it, so
+// it is closed when the last holder releases it.
+type Multiton[K comparable, V any] struct {
+	mu      sync.Mutex
+	create  func(key K) (V, error)
+	busy    func(V) bool
+	onEvict func(key K, value V)
+	entries map[K]*multitonEntry[V]
+	// retired holds the detached entries that are still held.
+	retired map[*multitonEntry[V]]K
+	closed  bool
+	now     func() time.Time
+}
+
+func NewMultiton[K comparable, V any](create func(key K) (V, error)) *Multiton[K, V] {
+	return &Multiton[K, V]{
+		create:  create,
+		entries: make(map[K]*multitonEntry[V]),
+		retired: make(map[*multitonEntry[V]]K),
+		now:     time.Now,
+	}
+}
+
+// SetBusyCheck makes EvictIdle skip instances for which busy returns true,
+// such as a database with connections still borrowed.
+func (m *Multiton[K, V]) SetBusyCheck(busy func(V) bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.busy = busy
+}
+
+// SetOnEvict registers a callback run after an instance is removed and,
+// if it implements io.Closer, closed.
+func (m *Multiton[K, V]) SetOnEvict(fn func(key K, value V)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.onEvict = fn
+}
+
+// Get returns the instance for key without holding it, so EvictIdle,
+// Remove or Close may close it while the caller still uses it. Use Acquire
+// when that matters.
+func (m *Multiton[K, V]) Get(key K) (V, error) {
+	entry, err := m.entry(key, false)
+	if err != nil {
+		var zero V
+		return zero, err
+	}
+	return entry.value, nil
+}
+
+// Acquire returns the instance for key and holds it until release is
+// called. release may be called more than once; the error it returns comes
+// from closing an instance that was removed while held.
+func (m *Multiton[K, V]) Acquire(key K) (value V, release func() error, err error) {
+	entry, err := m.entry(key, true)
+	if err != nil {
+		return value, nil, err
+	}
+	return entry.value, sync.OnceValue(func() error { return m.unref(key, entry) }), nil
+}
+
+func (m *Multiton[K, V]) entry(key K, hold bool) (*multitonEntry[V], error) {
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return nil, ErrMultitonClosed
+	}
+	entry, ok := m.entries[key]
+	if ok {
+		entry.hits++
+		entry.lastUsed = m.now()
+		if hold {
+			entry.refs++
+		}
+		m.mu.Unlock()
+		<-entry.ready
+		if entry.err != nil {
+			if hold {
+				m.unref(key, entry)
+			}
+			return nil, entry.err
+		}
+		return entry, nil
+	}
+	now := m.now()
+	entry = &multitonEntry[V]{ready: make(chan struct{}), done: make(chan struct{}), createdAt: now, lastUsed: now, hits: 1}
+	if hold {
+		entry.refs = 1
+	}
+	m.entries[key] = entry
+	m.mu.Unlock()
+
+	entry.value, entry.err = m.create(key)
+	if entry.err != nil {
+		m.mu.Lock()
+		if m.entries[key] == entry {
+			delete(m.entries, key)
+		}
+		m.mu.Unlock()
+	}
+	close(entry.ready)
+	if entry.err != nil {
+		if hold {
+			m.unref(key, entry)
+		}
+		return nil, entry.err
+	}
+	return entry, nil
+}
+
+// unref drops one hold on entry and closes it if it was the last hold on a
+// retired entry.
+func (m *Multiton[K, V]) unref(key K, entry *multitonEntry[V]) error {
+	m.mu.Lock()
+	entry.refs--
+	last := entry.retired && entry.refs == 0
+	if last {
+		delete(m.retired, entry)
+	}
+	m.mu.Unlock()
+	if !last {
+		return nil
+	}
+	return m.release([]K{key}, map[K]*multitonEntry[V]{key: entry})
+}
+
+// Stats describes every live instance, ordered by key.
+func (m *Multiton[K, V]) Stats() []InstanceStats[K] {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stats := make([]InstanceStats[K], 0, len(m.entries))
+	for key, entry := range m.entries {
+		stats = append(stats, InstanceStats[K]{Key: key, CreatedAt: entry.createdAt, LastUsed: entry.lastUsed, Hits: entry.hits, Held: entry.refs})
+	}
+	sort.Slice(stats, func(i, j int) bool { return fmt.Sprint(stats[i].Key) < fmt.Sprint(stats[j].Key) })
+	return stats
+}
+
+func (m *Multiton[K, V]) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.entries)
+}
+
+// EvictIdle removes the instances not used for longer than maxIdle and
+// returns their keys. Instances still being built, held or reported busy
+// stay.
+func (m *Multiton[K, V]) EvictIdle(maxIdle time.Duration) ([]K, error) {
+	m.mu.Lock()
+	cutoff := m.now().Add(-maxIdle)
+	evicted := make(map[K]*multitonEntry[V])
+	for key, entry := range m.entries {
+		select {
+		case <-entry.ready:
+		default:
+			continue
+		}
+		if entry.refs > 0 || !entry.lastUsed.Before(cutoff) || (m.busy != nil && m.busy(entry.value)) {
+			continue
+		}
+		evicted[key] = entry
+		delete(m.entries, key)
+	}
+	m.mu.Unlock()
+
+	keys := make([]K, 0, len(evicted))
+	for key := range evicted {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return fmt.Sprint(keys[i]) < fmt.Sprint(keys[j]) })
+	return keys, m.release(keys, evicted)
+}
+
+// Remove evicts key regardless of when it was last used. The next Get
+// builds a new instance. A held instance is closed when it is released.
+func (m *Multiton[K, V]) Remove(key K) error {
+	m.mu.Lock()
+	entry, ok := m.entries[key]
+	if ok {
+		delete(m.entries, key)
+	}
+	m.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	return m.retire(map[K]*multitonEntry[V]{key: entry})
+}
+
+// RunEviction calls EvictIdle every interval until ctx is done.
+func (m *Multiton[K, V]) RunEviction(ctx context.Context, interval, maxIdle time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.EvictIdle(maxIdle)
+		}
+	}
+}
+
+// Close evicts every instance and makes further Get calls fail. Held
+// instances are closed when they are released.
+func (m *Multiton[K, V]) Close() error {
+	m.mu.Lock()
+	m.closed = true
+	entries := m.entries
+	m.entries = make(map[K]*multitonEntry[V])
+	m.mu.Unlock()
+	return m.retire(entries)
+}
+
+// Stop closes the multiton and waits until every held instance has been
+// released and closed, or ctx is done.
+func (m *Multiton[K, V]) Stop(ctx context.Context) error {
+	err := m.Close()
+	m.mu.Lock()
+	pending := make([]*multitonEntry[V], 0, len(m.retired))
+	for entry := range m.retired {
+		pending = append(pending, entry)
+	}
+	m.mu.Unlock()
+	for _, entry := range pending {
+		select {
+		case <-entry.done:
+		case <-ctx.Done():
+			m.mu.Lock()
+			held := len(m.retired)
+			m.mu.Unlock()
+			return errors.Join(err, fmt.Errorf("%d instances still held: %w", held, ctx.Err()))
+		}
+	}
+	return err
+}
+
+// retire closes the entries, which have left the map, once they are built.
+// Held entries are closed later by their last release.
+func (m *Multiton[K, V]) retire(entries map[K]*multitonEntry[V]) error {
+	var keys []K
+	m.mu.Lock()
+	for key, entry := range entries {
+		entry.retired = true
+		if entry.refs > 0 {
+			m.retired[entry] = key
+			continue
+		}
+		keys = append(keys, key)
+	}
+	m.mu.Unlock()
+	for _, key := range keys {
+		<-entries[key].ready
+	}
+	return m.release(keys, entries)
+}
+
+func (m *Multiton[K, V]) release(keys []K, entries map[K]*multitonEntry[V]) error {
+	m.mu.Lock()
+	onEvict := m.onEvict
+	m.mu.Unlock()
+	var errs []error
+	for _, key := range keys {
+		entry := entries[key]
+		defer close(entry.done)
+		if entry.err != nil {
+			continue
+		}
+		if closer, ok := any(entry.value).(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				errs = append(errs, fmt.Errorf("closing %v: %w", key, err))
+			}
+		}
+		if onEvict != nil {
+			onEvict(key, entry.value)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type closeCounter struct{ closed atomic.Int32 }
+
+func (c *closeCounter) Close() error {
+	c.closed.Add(1)
+	return nil
+}
+
+func newCountingMultiton() *Multiton[string, *closeCounter] {
+	return NewMultiton(func(key string) (*closeCounter, error) {
+		if key == "bad" {
+			return nil, errors.New("cannot build")
+		}
+		return &closeCounter{}, nil
+	})
+}
+
+func TestMultitonKeepsHeldInstancesOpen(t *testing.T) {
+	m := newCountingMultiton()
+	held, release, err := m.Acquire("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	idle, _ := m.Get("b")
+
+	time.Sleep(5 * time.Millisecond)
+	evicted, _ := m.EvictIdle(time.Millisecond)
+	if len(evicted) != 1 || evicted[0] != "b" || idle.closed.Load() != 1 {
+		t.Errorf("EvictIdle evicted %v, want only the unheld b", evicted)
+	}
+
+	m.Remove("a")
+	if held.closed.Load() != 0 {
+		t.Fatal("Remove closed an instance that is still held")
+	}
+	if fresh, _ := m.Get("a"); fresh == held {
+		t.Error("Get after Remove returned the removed instance")
+	}
+	release()
+	release()
+	if n := held.closed.Load(); n != 1 {
+		t.Errorf("released instance closed %d times, want once", n)
+	}
+}
+
+func TestMultitonFailedAcquireHoldsNothing(t *testing.T) {
+	m := newCountingMultiton()
+	if _, _, err := m.Acquire("bad"); err == nil {
+		t.Fatal("Acquire of a failing key succeeded")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := m.Stop(ctx); err != nil {
+		t.Errorf("Stop: %v", err)
+	}
+}
+
+func TestMultitonStopWaitsForHolders(t *testing.T) {
+	m := newCountingMultiton()
+	held, release, _ := m.Acquire("a")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := m.Stop(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Stop with a held instance: got %v, want a timeout", err)
+	}
+	if _, err := m.Get("a"); !errors.Is(err, ErrMultitonClosed) {
+		t.Errorf("Get after Stop: got %v, want ErrMultitonClosed", err)
+	}
+
+	time.AfterFunc(10*time.Millisecond, func() { release() })
+	if err := m.Stop(context.Background()); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	if held.closed.Load() != 1 {
+		t.Error("Stop returned before the held instance was closed")
+	}
+}
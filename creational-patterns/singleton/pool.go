@@ -0,0 +1,276 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var (
+	ErrPoolClosed     = errors.New("connection pool is closed")
+	ErrAcquireTimeout = errors.New("timed out waiting for a connection")
+	ErrBadConn        = errors.New("bad connection")
+)
+
+type Rows [][]string
+
+type Conn interface {
+	Query(query string) (Rows, error)
+	Ping() error
+	Close() error
+}
+
+type Driver interface {
+	Open(dsn string) (Conn, error)
+}
+
+type PoolConfig struct {
+	MaxOpen             int
+	MaxIdle             int
+	AcquireTimeout      time.Duration
+	HealthCheckInterval time.Duration
+}
+
+type PoolStats struct {
+	Open        int
+	Idle        int
+	InUse       int
+	Acquired    int64
+	Opened      int64
+	Closed      int64
+	Timeouts    int64
+	HealthFails int64
+}
+
+type idleConn struct {
+	conn      Conn
+	idleSince time.Time
+}
+
+type Pool struct {
+	driver Driver
+	dsn    string
+	config PoolConfig
+	slots  chan struct{}
+
+	// drainLock serializes Shutdown calls. drained counts the slots they
+	// have taken, so a later call resumes or returns at once.
+	drainLock chan struct{}
+	drained   int
+
+	mu     sync.Mutex
+	idle   []idleConn
+	stats  PoolStats
+	closed bool
+	// done is closed by Close, waking Acquire calls that wait for a slot.
+	done chan struct{}
+}
+
+func NewPool(driver Driver, dsn string, config PoolConfig) *Pool {
+	if config.MaxOpen <= 0 {
+		config.MaxOpen = 10
+	}
+	switch {
+	case config.MaxIdle == 0:
+		config.MaxIdle = min(config.MaxOpen, 2)
+	case config.MaxIdle < 0 || config.MaxIdle > config.MaxOpen:
+		config.MaxIdle = config.MaxOpen
+	}
+	if config.AcquireTimeout <= 0 {
+		config.AcquireTimeout = 5 * time.Second
+	}
+	return &Pool{
+		driver:    driver,
+		dsn:       dsn,
+		config:    config,
+		slots:     make(chan struct{}, config.MaxOpen),
+		drainLock: make(chan struct{}, 1),
+		done:      make(chan struct{}),
+	}
+}
+
+func (p *Pool) Acquire(parent context.Context) (*PooledConn, error) {
+	ctx, cancel := context.WithTimeout(parent, p.config.AcquireTimeout)
+	defer cancel()
+
+	select {
+	case <-p.done:
+		return nil, ErrPoolClosed
+	default:
+	}
+	select {
+	case p.slots <- struct{}{}:
+	case <-p.done:
+		return nil, ErrPoolClosed
+	case <-ctx.Done():
+		p.mu.Lock()
+		p.stats.Timeouts++
+		p.mu.Unlock()
+		if err := parent.Err(); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrAcquireTimeout, err)
+		}
+		return nil, fmt.Errorf("%w after %s", ErrAcquireTimeout, p.config.AcquireTimeout)
+	}
+
+	conn, err := p.take()
+	if err != nil {
+		<-p.slots
+		return nil, err
+	}
+	return &PooledConn{pool: p, conn: conn}, nil
+}
+
+func (p *Pool) take() (Conn, error) {
+	for {
+		p.mu.Lock()
+		if p.closed {
+			p.mu.Unlock()
+			return nil, ErrPoolClosed
+		}
+		if n := len(p.idle); n > 0 {
+			ic := p.idle[n-1]
+			p.idle = p.idle[:n-1]
+			p.mu.Unlock()
+			if p.config.HealthCheckInterval > 0 && time.Since(ic.idleSince) >= p.config.HealthCheckInterval {
+				if err := ic.conn.Ping(); err != nil {
+					ic.conn.Close()
+					p.mu.Lock()
+					p.stats.HealthFails++
+					p.stats.Open--
+					p.stats.Closed++
+					p.mu.Unlock()
+					continue
+				}
+			}
+			p.mu.Lock()
+			p.stats.Acquired++
+			p.stats.InUse++
+			p.mu.Unlock()
+			return ic.conn, nil
+		}
+		p.mu.Unlock()
+
+		conn, err := p.driver.Open(p.dsn)
+		if err != nil {
+			return nil, fmt.Errorf("opening connection to %s: %w", p.dsn, err)
+		}
+		p.mu.Lock()
+		p.stats.Open++
+		p.stats.Opened++
+		p.stats.Acquired++
+		p.stats.InUse++
+		p.mu.Unlock()
+		return conn, nil
+	}
+}
+
+func (p *Pool) release(conn Conn, broken bool) {
+	defer func() { <-p.slots }()
+	p.mu.Lock()
+	p.stats.InUse--
+	if broken || p.closed || len(p.idle) >= p.config.MaxIdle {
+		p.stats.Open--
+		p.stats.Closed++
+		p.mu.Unlock()
+		conn.Close()
+		return
+	}
+	p.idle = append(p.idle, idleConn{conn: conn, idleSince: time.Now()})
+	p.mu.Unlock()
+}
+
+// Close closes every idle connection and makes further Acquire calls fail.
+// Connections that are still borrowed are closed when they are released.
+func (p *Pool) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	close(p.done)
+	idle := p.idle
+	p.idle = nil
+	p.stats.Open -= len(idle)
+	p.stats.Closed += int64(len(idle))
+	p.mu.Unlock()
+
+	var errs []error
+	for _, ic := range idle {
+		if err := ic.conn.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Shutdown closes the pool and waits until every borrowed connection has
+// been released and closed, or ctx is done. It may be called again, for
+// example after a timeout; once the pool is drained it returns at once.
+func (p *Pool) Shutdown(ctx context.Context) error {
+	err := p.Close()
+	stillInUse := func() error {
+		return errors.Join(err, fmt.Errorf("%d connections still in use: %w", p.Stats().InUse, ctx.Err()))
+	}
+	select {
+	case p.drainLock <- struct{}{}:
+	case <-ctx.Done():
+		return stillInUse()
+	}
+	defer func() { <-p.drainLock }()
+	for ; p.drained < cap(p.slots); p.drained++ {
+		select {
+		case p.slots <- struct{}{}:
+		case <-ctx.Done():
+			return stillInUse()
+		}
+	}
+	return err
+}
+
+func (p *Pool) Stats() PoolStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	stats := p.stats
+	stats.Idle = len(p.idle)
+	return stats
+}
+
+type PooledConn struct {
+	pool     *Pool
+	conn     Conn
+	broken   bool
+	released bool
+}
+
+func (c *PooledConn) Query(query string) (Rows, error) {
+	if c.released {
+		return nil, errors.New("query on a released connection")
+	}
+	rows, err := c.conn.Query(query)
+	if errors.Is(err, ErrBadConn) {
+		c.broken = true
+	}
+	return rows, err
+}
+
+func (c *PooledConn) Ping() error {
+	if c.released {
+		return errors.New("ping on a released connection")
+	}
+	err := c.conn.Ping()
+	if err != nil {
+		c.broken = true
+	}
+	return err
+}
+
+func (c *PooledConn) Release() {
+	if c.released {
+		return
+	}
+	c.released = true
+	c.pool.release(c.conn, c.broken)
+}
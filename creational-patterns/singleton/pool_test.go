@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPoolAcquireTimeout(t *testing.T) {
+	pool := NewPool(NewMemoryDriver(), "mem://test", PoolConfig{MaxOpen: 1, AcquireTimeout: 20 * time.Millisecond})
+	defer pool.Close()
+	conn, err := pool.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Release()
+
+	start := time.Now()
+	if _, err := pool.Acquire(context.Background()); !errors.Is(err, ErrAcquireTimeout) {
+		t.Fatalf("got %v, want ErrAcquireTimeout", err)
+	}
+	if waited := time.Since(start); waited < 20*time.Millisecond {
+		t.Errorf("Acquire gave up after %s, before the 20ms timeout", waited)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := pool.Acquire(ctx); !errors.Is(err, ErrAcquireTimeout) || !errors.Is(err, context.Canceled) {
+		t.Errorf("with a cancelled context: got %v, want ErrAcquireTimeout wrapping context.Canceled", err)
+	}
+	if got := pool.Stats().Timeouts; got != 2 {
+		t.Errorf("Timeouts = %d, want 2", got)
+	}
+}
+
+func TestPoolRespectsMaxOpen(t *testing.T) {
+	const maxOpen = 3
+	pool := NewPool(NewMemoryDriver(), "mem://test", PoolConfig{MaxOpen: maxOpen, MaxIdle: maxOpen, AcquireTimeout: time.Second})
+	defer pool.Close()
+
+	var inUse, peak atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			conn, err := pool.Acquire(context.Background())
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			n := inUse.Add(1)
+			for {
+				p := peak.Load()
+				if n <= p || peak.CompareAndSwap(p, n) {
+					break
+				}
+			}
+			time.Sleep(time.Millisecond)
+			inUse.Add(-1)
+			conn.Release()
+		}()
+	}
+	wg.Wait()
+
+	if got := peak.Load(); got > maxOpen {
+		t.Errorf("%d connections were in use at once, want at most %d", got, maxOpen)
+	}
+	stats := pool.Stats()
+	if stats.Opened > maxOpen || stats.Open > maxOpen {
+		t.Errorf("opened %d connections (%d still open), want at most %d", stats.Opened, stats.Open, maxOpen)
+	}
+}
+
+func TestPoolDefaultMaxIdle(t *testing.T) {
+	tests := []struct{ maxOpen, maxIdle, want int }{
+		{maxOpen: 10, maxIdle: 0, want: 2},
+		{maxOpen: 1, maxIdle: 0, want: 1},
+		{maxOpen: 4, maxIdle: 3, want: 3},
+		{maxOpen: 4, maxIdle: 9, want: 4},
+	}
+	for _, tt := range tests {
+		pool := NewPool(NewMemoryDriver(), "mem://test", PoolConfig{MaxOpen: tt.maxOpen, MaxIdle: tt.maxIdle})
+		if got := pool.config.MaxIdle; got != tt.want {
+			t.Errorf("MaxOpen %d, MaxIdle %d: got MaxIdle %d, want %d", tt.maxOpen, tt.maxIdle, got, tt.want)
+		}
+	}
+}
+
+func TestPoolReplacesConnectionsThatFailHealthCheck(t *testing.T) {
+	driver := NewMemoryDriver()
+	pool := NewPool(driver, "mem://test", PoolConfig{MaxOpen: 2, HealthCheckInterval: time.Nanosecond})
+	defer pool.Close()
+
+	conn, err := pool.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Release()
+	driver.Restart()
+
+	conn, err = pool.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Release()
+	if err := conn.Ping(); err != nil {
+		t.Errorf("Acquire returned a connection that fails Ping: %v", err)
+	}
+	stats := pool.Stats()
+	if stats.HealthFails != 1 || stats.Opened != 2 || stats.Open != 1 {
+		t.Errorf("stats = %+v, want 1 health failure, 2 opened and 1 open", stats)
+	}
+}
+
+func TestPoolDiscardsBadConnections(t *testing.T) {
+	driver := NewMemoryDriver()
+	pool := NewPool(driver, "mem://test", PoolConfig{MaxOpen: 2})
+	defer pool.Close()
+
+	conn, err := pool.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	driver.Restart()
+	if _, err := conn.Query("SELECT * FROM users"); !errors.Is(err, ErrBadConn) {
+		t.Fatalf("got %v, want ErrBadConn", err)
+	}
+	conn.Release()
+	if stats := pool.Stats(); stats.Idle != 0 || stats.Open != 0 {
+		t.Errorf("stats = %+v, want the bad connection closed rather than pooled", stats)
+	}
+}
+
+func TestPoolClose(t *testing.T) {
+	pool := NewPool(NewMemoryDriver(), "mem://test", PoolConfig{MaxOpen: 2})
+	idle, err := pool.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	borrowed, err := pool.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	idle.Release()
+
+	if err := pool.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := pool.Close(); err != nil {
+		t.Errorf("second Close: %v", err)
+	}
+	if _, err := pool.Acquire(context.Background()); !errors.Is(err, ErrPoolClosed) {
+		t.Errorf("Acquire after Close: got %v, want ErrPoolClosed", err)
+	}
+	if stats := pool.Stats(); stats.Open != 1 || stats.InUse != 1 {
+		t.Errorf("after Close: stats = %+v, want only the borrowed connection open", stats)
+	}
+
+	raw := borrowed.conn
+	borrowed.Release()
+	if stats := pool.Stats(); stats.Open != 0 || stats.Closed != 2 {
+		t.Errorf("after releasing: stats = %+v, want every connection closed", stats)
+	}
+	if err := raw.Ping(); !errors.Is(err, ErrBadConn) {
+		t.Errorf("a connection released after Close was not closed: Ping returned %v", err)
+	}
+}
+
+func TestPoolShutdownCanBeRepeated(t *testing.T) {
+	pool := NewPool(NewMemoryDriver(), "mem://test", PoolConfig{MaxOpen: 2})
+	borrowed, err := pool.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := pool.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Shutdown with a borrowed connection: got %v, want a timeout", err)
+	}
+
+	borrowed.Release()
+	for i := 0; i < 2; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		err := pool.Shutdown(ctx)
+		cancel()
+		if err != nil {
+			t.Fatalf("Shutdown %d after the release: %v", i+2, err)
+		}
+	}
+}
+
+func TestPoolAcquireAfterShutdown(t *testing.T) {
+	pool := NewPool(NewMemoryDriver(), "mem://test", PoolConfig{MaxOpen: 1, AcquireTimeout: time.Second})
+	if err := pool.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	if _, err := pool.Acquire(context.Background()); !errors.Is(err, ErrPoolClosed) {
+		t.Errorf("Acquire after Shutdown: got %v, want ErrPoolClosed", err)
+	}
+	if waited := time.Since(start); waited > 100*time.Millisecond {
+		t.Errorf("Acquire after Shutdown waited %s", waited)
+	}
+}
+
+func TestPoolCloseWakesWaitingAcquire(t *testing.T) {
+	pool := NewPool(NewMemoryDriver(), "mem://test", PoolConfig{MaxOpen: 1, AcquireTimeout: time.Second})
+	conn, err := pool.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Release()
+
+	result := make(chan error, 1)
+	go func() {
+		_, err := pool.Acquire(context.Background())
+		result <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	pool.Close()
+	select {
+	case err := <-result:
+		if !errors.Is(err, ErrPoolClosed) {
+			t.Errorf("waiting Acquire: got %v, want ErrPoolClosed", err)
+		}
+	case <-time.After(500 * time.Millisecond):
+		t.Fatal("a waiting Acquire was not woken by Close")
+	}
+}
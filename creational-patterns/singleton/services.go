@@ -0,0 +1,430 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+var (
+	ErrServiceNotFound = errors.New("service not registered")
+	ErrDependencyCycle = errors.New("dependency cycle")
+	ErrScopeRequired   = errors.New("scoped service resolved outside a scope")
+	ErrScopeClosed     = errors.New("scope is closed")
+	ErrServiceType     = errors.New("service has unexpected type")
+	ErrServiceReset    = errors.New("registry was reset while the service was built")
+)
+
+type Lifetime int
+
+const (
+	// LifetimeSingleton services are built once per registry.
+	LifetimeSingleton Lifetime = iota
+	// LifetimeScoped services are built once per Scope and closed with it.
+	LifetimeScoped
+	// LifetimeTransient services are built on every resolve.
+	LifetimeTransient
+)
+
+func (l Lifetime) String() string {
+	switch l {
+	case LifetimeSingleton:
+		return "singleton"
+	case LifetimeScoped:
+		return "scoped"
+	default:
+		return "transient"
+	}
+}
+
+// Container resolves services by name. ServiceRegistry, Scope and the
+// Resolver handed to factories all implement it.
+type Container interface {
+	Get(name string) (interface{}, error)
+}
+
+type ServiceFactory func(c Container) (interface{}, error)
+
+type serviceProvider struct {
+	lifetime Lifetime
+	factory  ServiceFactory
+}
+
+// ServiceRegistry builds services lazily on first use and caches them
+// according to their lifetime. Each singleton or scoped instance has its own
+// build, so concurrent first users wait for one build of that service while
+// other services build in parallel, and a factory may call a global accessor
+// such as GetLoggerInstance for another service.
+//
+// Cycles are found through the Container handed to each factory: it carries
+// the chain of builds it belongs to, including builds that wait for one
+// another on different goroutines. A factory must therefore resolve its own
+// dependencies through that Container; a cycle that goes through a global
+// accessor cannot be seen and deadlocks.
+type ServiceRegistry struct {
+	mu        sync.RWMutex
+	providers map[string]serviceProvider
+	instances map[string]interface{}
+	order     []string
+	overrides map[string]interface{}
+	building  map[buildKey]*serviceBuild
+	// generation changes on Reset. A build that started before it is not
+	// cached.
+	generation int
+}
+
+// buildKey names one instance being built: scope is nil for singletons.
+type buildKey struct {
+	name  string
+	scope *Scope
+}
+
+// serviceBuild is an instance under construction. waitingOn is the build
+// its factory currently waits for, if any; following these links from a
+// build back to itself is a cycle. Guarded by the registry's mu.
+type serviceBuild struct {
+	done      chan struct{}
+	path      []string
+	waitingOn *serviceBuild
+}
+
+func NewServiceRegistry() *ServiceRegistry {
+	return &ServiceRegistry{
+		providers: make(map[string]serviceProvider),
+		instances: make(map[string]interface{}),
+		overrides: make(map[string]interface{}),
+		building:  make(map[buildKey]*serviceBuild),
+	}
+}
+
+// Register adds or replaces the provider for name. Replacing a provider
+// drops an instance already built from the old one and, if it implements
+// io.Closer, closes it; the error is that of Close.
+func (r *ServiceRegistry) Register(name string, lifetime Lifetime, factory ServiceFactory) error {
+	r.mu.Lock()
+	r.providers[name] = serviceProvider{lifetime: lifetime, factory: factory}
+	instance, ok := r.instances[name]
+	if ok {
+		delete(r.instances, name)
+		for i, built := range r.order {
+			if built == name {
+				r.order = append(r.order[:i:i], r.order[i+1:]...)
+				break
+			}
+		}
+	}
+	r.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	return closeInReverse(map[string]interface{}{name: instance}, []string{name})
+}
+
+// Override makes every resolve of name return instance until restore is
+// called, which brings back the previous override or the real service.
+// Tests pass restore to t.Cleanup.
+func (r *ServiceRegistry) Override(name string, instance interface{}) (restore func()) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	prev, hadPrev := r.overrides[name]
+	r.overrides[name] = instance
+	return func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if hadPrev {
+			r.overrides[name] = prev
+		} else {
+			delete(r.overrides, name)
+		}
+	}
+}
+
+// Reset drops all overrides and built singletons so the next resolve
+// builds fresh instances. Dropped instances that implement io.Closer are
+// closed in reverse order of creation. Reset does not wait for builds in
+// progress, so a factory may call it: their instances are closed instead of
+// cached, and the resolves that started them get ErrServiceReset.
+func (r *ServiceRegistry) Reset() error {
+	r.mu.Lock()
+	instances, order := r.instances, r.order
+	r.instances = make(map[string]interface{})
+	r.order = nil
+	r.overrides = make(map[string]interface{})
+	r.generation++
+	r.mu.Unlock()
+	return closeInReverse(instances, order)
+}
+
+func (r *ServiceRegistry) Get(name string) (interface{}, error) {
+	return r.resolve(name, nil, nil, nil)
+}
+
+func (r *ServiceRegistry) NewScope() *Scope {
+	return &Scope{registry: r, instances: make(map[string]interface{})}
+}
+
+// resolve returns the instance for name. path lists the services whose
+// factories led here and parent is the build whose factory is asking, both
+// empty for a call from outside a factory.
+func (r *ServiceRegistry) resolve(name string, scope *Scope, path []string, parent *serviceBuild) (interface{}, error) {
+	for _, seen := range path {
+		if seen == name {
+			return nil, fmt.Errorf("%w: %s -> %s", ErrDependencyCycle, strings.Join(path, " -> "), name)
+		}
+	}
+
+	r.mu.RLock()
+	if instance, ok := r.overrides[name]; ok {
+		r.mu.RUnlock()
+		return instance, nil
+	}
+	provider, ok := r.providers[name]
+	instance, built := r.instances[name]
+	r.mu.RUnlock()
+	if !ok {
+		if len(path) > 0 {
+			return nil, fmt.Errorf("%w: %s (needed by %s)", ErrServiceNotFound, name, path[len(path)-1])
+		}
+		return nil, fmt.Errorf("%w: %s", ErrServiceNotFound, name)
+	}
+	if provider.lifetime == LifetimeSingleton && built {
+		return instance, nil
+	}
+	if provider.lifetime == LifetimeScoped {
+		if scope == nil {
+			return nil, fmt.Errorf("%w: %s", ErrScopeRequired, name)
+		}
+		if instance, ok, err := scope.cached(name); ok || err != nil {
+			return instance, err
+		}
+	}
+
+	if provider.lifetime == LifetimeTransient {
+		return r.build(name, provider, scope, path, parent)
+	}
+
+	key := buildKey{name: name}
+	if provider.lifetime == LifetimeScoped {
+		key.scope = scope
+	}
+	var b *serviceBuild
+	var generation int
+	for b == nil {
+		r.mu.Lock()
+		if instance, ok, err := r.cachedLocked(name, provider.lifetime, scope); ok || err != nil {
+			r.mu.Unlock()
+			return instance, err
+		}
+		pending, inFlight := r.building[key]
+		if !inFlight {
+			b = &serviceBuild{done: make(chan struct{}), path: append(append([]string(nil), path...), name)}
+			r.building[key] = b
+			generation = r.generation
+			r.mu.Unlock()
+			break
+		}
+		if parent != nil {
+			if waitsOn(pending, parent) {
+				r.mu.Unlock()
+				chain := append(append(append([]string(nil), pending.path...), path...), name)
+				return nil, fmt.Errorf("%w: %s", ErrDependencyCycle, strings.Join(chain, " -> "))
+			}
+			parent.waitingOn = pending
+		}
+		r.mu.Unlock()
+		<-pending.done
+		if parent != nil {
+			r.mu.Lock()
+			parent.waitingOn = nil
+			r.mu.Unlock()
+		}
+	}
+	defer func() {
+		r.mu.Lock()
+		if r.building[key] == b {
+			delete(r.building, key)
+		}
+		r.mu.Unlock()
+		close(b.done)
+	}()
+
+	instance, err := r.build(name, provider, scope, path, b)
+	if err != nil {
+		return nil, err
+	}
+	switch provider.lifetime {
+	case LifetimeSingleton:
+		r.mu.Lock()
+		if r.generation != generation {
+			r.mu.Unlock()
+			return nil, errors.Join(fmt.Errorf("%w: %s", ErrServiceReset, name),
+				closeInReverse(map[string]interface{}{name: instance}, []string{name}))
+		}
+		r.instances[name] = instance
+		r.order = append(r.order, name)
+		r.mu.Unlock()
+	case LifetimeScoped:
+		scope.store(name, instance)
+	}
+	return instance, nil
+}
+
+// waitsOn reports whether waiting for b would wait for target: b is target,
+// or b's factory already waits, directly or through other builds, for
+// target. Called with the registry's mu held.
+func waitsOn(b, target *serviceBuild) bool {
+	for seen := map[*serviceBuild]bool{}; b != nil && !seen[b]; b = b.waitingOn {
+		if b == target {
+			return true
+		}
+		seen[b] = true
+	}
+	return false
+}
+
+// cachedLocked returns an instance that is already built. Called with r.mu
+// held.
+func (r *ServiceRegistry) cachedLocked(name string, lifetime Lifetime, scope *Scope) (interface{}, bool, error) {
+	if lifetime == LifetimeScoped {
+		return scope.cached(name)
+	}
+	instance, ok := r.instances[name]
+	return instance, ok, nil
+}
+
+// build runs the factory. parent is the build the instance belongs to: the
+// new build for singletons and scoped services, the caller's for transient
+// ones.
+func (r *ServiceRegistry) build(name string, provider serviceProvider, scope *Scope, path []string, parent *serviceBuild) (interface{}, error) {
+	// Singletons never see the scope, so a singleton that depends on a
+	// scoped service fails instead of keeping it alive past its scope.
+	factoryScope := scope
+	if provider.lifetime == LifetimeSingleton {
+		factoryScope = nil
+	}
+	resolver := &Resolver{registry: r, scope: factoryScope, path: append(append([]string(nil), path...), name), build: parent}
+	instance, err := provider.factory(resolver)
+	if errors.Is(err, ErrDependencyCycle) {
+		return nil, err
+	} else if err != nil {
+		return nil, fmt.Errorf("building %s: %w", name, err)
+	}
+	return instance, nil
+}
+
+// Resolver is the Container passed to factories. It carries the chain of
+// services being built so that cycles are reported instead of recursing.
+type Resolver struct {
+	registry *ServiceRegistry
+	scope    *Scope
+	path     []string
+	build    *serviceBuild
+}
+
+func (r *Resolver) Get(name string) (interface{}, error) {
+	return r.registry.resolve(name, r.scope, r.path, r.build)
+}
+
+// Scope holds the instances of scoped services, for example one per
+// request or per test. Singletons still come from the registry.
+type Scope struct {
+	registry  *ServiceRegistry
+	mu        sync.Mutex
+	instances map[string]interface{}
+	order     []string
+	closed    bool
+}
+
+func (s *Scope) Get(name string) (interface{}, error) {
+	return s.registry.resolve(name, s, nil, nil)
+}
+
+func (s *Scope) cached(name string) (interface{}, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil, false, fmt.Errorf("%w: resolving %s", ErrScopeClosed, name)
+	}
+	instance, ok := s.instances[name]
+	return instance, ok, nil
+}
+
+func (s *Scope) store(name string, instance interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.instances[name] = instance
+	s.order = append(s.order, name)
+}
+
+// Close closes the scope's instances that implement io.Closer, newest
+// first.
+func (s *Scope) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	instances, order := s.instances, s.order
+	s.instances, s.order = nil, nil
+	s.mu.Unlock()
+	return closeInReverse(instances, order)
+}
+
+func closeInReverse(instances map[string]interface{}, order []string) error {
+	var errs []error
+	for i := len(order) - 1; i >= 0; i-- {
+		if closer, ok := instances[order[i]].(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				errs = append(errs, fmt.Errorf("closing %s: %w", order[i], err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// TypeKey is the name under which Provide registers services of type T.
+func TypeKey[T any]() string {
+	return reflect.TypeOf((*T)(nil)).Elem().String()
+}
+
+// Provide registers a factory for T under TypeKey[T](), as Register does.
+func Provide[T any](r *ServiceRegistry, lifetime Lifetime, factory func(c Container) (T, error)) error {
+	return r.Register(TypeKey[T](), lifetime, func(c Container) (interface{}, error) {
+		return factory(c)
+	})
+}
+
+func Resolve[T any](c Container) (T, error) {
+	return ResolveNamed[T](c, TypeKey[T]())
+}
+
+func ResolveNamed[T any](c Container, name string) (T, error) {
+	var zero T
+	instance, err := c.Get(name)
+	if err != nil {
+		return zero, err
+	}
+	typed, ok := instance.(T)
+	if !ok {
+		return zero, fmt.Errorf("%w: %s is %T, not %s", ErrServiceType, name, instance, TypeKey[T]())
+	}
+	return typed, nil
+}
+
+// MustResolve is Resolve for services that the program cannot run without.
+func MustResolve[T any](c Container) T {
+	instance, err := Resolve[T](c)
+	if err != nil {
+		panic(err)
+	}
+	return instance
+}
+
+// OverrideType is Override keyed by TypeKey[T]().
+func OverrideType[T any](r *ServiceRegistry, instance T) (restore func()) {
+	return r.Override(TypeKey[T](), instance)
+}
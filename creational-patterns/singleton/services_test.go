@@ -0,0 +1,245 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// resolveWithin fails the test instead of hanging when a resolve deadlocks.
+func resolveWithin(t *testing.T, c Container, name string) (interface{}, error) {
+	t.Helper()
+	type result struct {
+		instance interface{}
+		err      error
+	}
+	done := make(chan result, 1)
+	go func() {
+		instance, err := c.Get(name)
+		done <- result{instance, err}
+	}()
+	select {
+	case r := <-done:
+		return r.instance, r.err
+	case <-time.After(2 * time.Second):
+		t.Fatalf("resolving %s deadlocked", name)
+		return nil, nil
+	}
+}
+
+type closeRecorder struct {
+	name   string
+	closed *[]string
+}
+
+func (c *closeRecorder) Close() error {
+	*c.closed = append(*c.closed, c.name)
+	return nil
+}
+
+func TestFactoryCanUseGlobalAccessor(t *testing.T) {
+	r := NewServiceRegistry()
+	r.Register("metrics", LifetimeSingleton, func(c Container) (interface{}, error) { return "metrics", nil })
+	r.Register("config", LifetimeSingleton, func(c Container) (interface{}, error) {
+		// Like calling GetMetricsRegistry() from inside a factory.
+		return r.Get("metrics")
+	})
+	if instance, err := resolveWithin(t, r, "config"); err != nil || instance != "metrics" {
+		t.Fatalf("got %v, %v", instance, err)
+	}
+}
+
+func TestCycleThroughTheContainerIsReported(t *testing.T) {
+	r := NewServiceRegistry()
+	r.Register("config", LifetimeSingleton, func(c Container) (interface{}, error) {
+		return c.Get("logger")
+	})
+	r.Register("logger", LifetimeTransient, func(c Container) (interface{}, error) {
+		return c.Get("config")
+	})
+	_, err := resolveWithin(t, r, "config")
+	if !errors.Is(err, ErrDependencyCycle) {
+		t.Fatalf("got %v, want ErrDependencyCycle", err)
+	}
+	if got, want := err.Error(), "dependency cycle: config -> logger -> config"; got != want {
+		t.Errorf("error = %q, want %q", got, want)
+	}
+}
+
+func TestConcurrentCycleIsReported(t *testing.T) {
+	r := NewServiceRegistry()
+	var started sync.WaitGroup
+	started.Add(2)
+	for _, pair := range [][2]string{{"a", "b"}, {"b", "a"}} {
+		name, dep := pair[0], pair[1]
+		var once sync.Once
+		r.Register(name, LifetimeSingleton, func(c Container) (interface{}, error) {
+			once.Do(func() {
+				started.Done()
+				started.Wait()
+			})
+			return c.Get(dep)
+		})
+	}
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	for i, name := range []string{"a", "b"} {
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+			_, errs[i] = r.Get(name)
+		}(i, name)
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("resolving a and b concurrently deadlocked")
+	}
+	for i, err := range errs {
+		if !errors.Is(err, ErrDependencyCycle) {
+			t.Errorf("resolve %d: got %v, want ErrDependencyCycle", i, err)
+		}
+	}
+}
+
+func TestSingletonIsBuiltOnceUnderConcurrentUse(t *testing.T) {
+	r := NewServiceRegistry()
+	var builds atomic.Int32
+	r.Register("db", LifetimeSingleton, func(c Container) (interface{}, error) {
+		builds.Add(1)
+		time.Sleep(10 * time.Millisecond)
+		return new(int), nil
+	})
+	var wg sync.WaitGroup
+	instances := make([]interface{}, 8)
+	for i := range instances {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			instances[i], _ = r.Get("db")
+		}(i)
+	}
+	wg.Wait()
+	if n := builds.Load(); n != 1 {
+		t.Errorf("built %d times", n)
+	}
+	for _, instance := range instances {
+		if instance != instances[0] {
+			t.Fatal("goroutines got different instances")
+		}
+	}
+}
+
+func TestOverrideAndReset(t *testing.T) {
+	var closed []string
+	r := NewServiceRegistry()
+	builds := 0
+	r.Register("db", LifetimeSingleton, func(c Container) (interface{}, error) {
+		builds++
+		return &closeRecorder{name: "db", closed: &closed}, nil
+	})
+	r.Register("cache", LifetimeSingleton, func(c Container) (interface{}, error) {
+		if _, err := c.Get("db"); err != nil {
+			return nil, err
+		}
+		return &closeRecorder{name: "cache", closed: &closed}, nil
+	})
+
+	real, _ := r.Get("db")
+	restoreOuter := r.Override("db", "fake-1")
+	restoreInner := r.Override("db", "fake-2")
+	if got, _ := r.Get("db"); got != "fake-2" {
+		t.Errorf("inner override: got %v", got)
+	}
+	restoreInner()
+	if got, _ := r.Get("db"); got != "fake-1" {
+		t.Errorf("after inner restore: got %v", got)
+	}
+	restoreOuter()
+	if got, _ := r.Get("db"); got != real {
+		t.Errorf("after outer restore: got %v, want the built instance", got)
+	}
+
+	r.Get("cache")
+	r.Override("db", "fake-3")
+	if err := r.Reset(); err != nil {
+		t.Fatal(err)
+	}
+	if len(closed) != 2 || closed[0] != "cache" || closed[1] != "db" {
+		t.Errorf("Reset closed %v, want [cache db]", closed)
+	}
+	fresh, _ := r.Get("db")
+	if fresh == real || fresh == "fake-3" || builds != 2 {
+		t.Errorf("after Reset got %v (builds %d), want a new instance", fresh, builds)
+	}
+}
+
+func TestRegisterClosesTheReplacedInstance(t *testing.T) {
+	var closed []string
+	r := NewServiceRegistry()
+	r.Register("db", LifetimeSingleton, func(c Container) (interface{}, error) {
+		return &closeRecorder{name: "old", closed: &closed}, nil
+	})
+	old, _ := r.Get("db")
+	if err := r.Register("db", LifetimeSingleton, func(c Container) (interface{}, error) {
+		return &closeRecorder{name: "new", closed: &closed}, nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(closed) != 1 || closed[0] != "old" {
+		t.Errorf("closed %v, want [old]", closed)
+	}
+	if fresh, _ := r.Get("db"); fresh == old {
+		t.Error("Get returned the replaced instance")
+	}
+}
+
+func TestResetFromAFactory(t *testing.T) {
+	var closed []string
+	r := NewServiceRegistry()
+	r.Register("db", LifetimeSingleton, func(c Container) (interface{}, error) {
+		return &closeRecorder{name: "db", closed: &closed}, nil
+	})
+	resets := 0
+	r.Register("cache", LifetimeSingleton, func(c Container) (interface{}, error) {
+		if _, err := c.Get("db"); err != nil {
+			return nil, err
+		}
+		if resets == 0 {
+			resets++
+			if err := r.Reset(); err != nil {
+				return nil, err
+			}
+		}
+		return &closeRecorder{name: "cache", closed: &closed}, nil
+	})
+
+	_, err := resolveWithin(t, r, "cache")
+	if !errors.Is(err, ErrServiceReset) {
+		t.Fatalf("got %v, want ErrServiceReset", err)
+	}
+	if len(closed) != 2 || closed[0] != "db" || closed[1] != "cache" {
+		t.Errorf("closed %v, want the reset db and then the discarded cache", closed)
+	}
+	if _, err := resolveWithin(t, r, "cache"); err != nil {
+		t.Errorf("resolving after the reset: %v", err)
+	}
+}
+
+func TestOverrideDefaultLogger(t *testing.T) {
+	memory := NewMemorySink()
+	logger := NewLogger(LevelDebug, TextFormatter{}, memory)
+	t.Cleanup(OverrideType(DefaultServices(), logger))
+
+	GetLoggerInstance().Info("captured")
+	if GetLoggerInstance() != logger || len(memory.Lines()) != 1 {
+		t.Errorf("the override was not used: %d lines captured", len(memory.Lines()))
+	}
+}
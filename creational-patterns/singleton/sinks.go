@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+type Formatter interface {
+	Format(entry Entry) ([]byte, error)
+}
+
+type TextFormatter struct{}
+
+func (TextFormatter) Format(e Entry) ([]byte, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "[%s] [%s] #%d: %s", e.Time.Format("15:04:05"), e.Level, e.Seq, e.Message)
+	for _, f := range e.Fields {
+		value := fmt.Sprint(f.Value)
+		if strings.ContainsAny(value, " \t\"=") {
+			value = strconv.Quote(value)
+		}
+		fmt.Fprintf(&b, " %s=%s", f.Key, value)
+	}
+	b.WriteByte('\n')
+	return []byte(b.String()), nil
+}
+
+type JSONFormatter struct{}
+
+func (JSONFormatter) Format(e Entry) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(`{"time":`)
+	writeJSON(&buf, e.Time.Format("2006-01-02T15:04:05.000Z07:00"))
+	buf.WriteString(`,"level":`)
+	writeJSON(&buf, e.Level.String())
+	buf.WriteString(`,"seq":`)
+	buf.WriteString(strconv.FormatInt(e.Seq, 10))
+	buf.WriteString(`,"msg":`)
+	writeJSON(&buf, e.Message)
+	for _, f := range e.Fields {
+		buf.WriteByte(',')
+		writeJSON(&buf, f.Key)
+		buf.WriteByte(':')
+		value := f.Value
+		if err, ok := value.(error); ok {
+			value = err.Error()
+		}
+		if err := writeJSON(&buf, value); err != nil {
+			writeJSON(&buf, fmt.Sprint(f.Value))
+		}
+	}
+	buf.WriteString("}\n")
+	return buf.Bytes(), nil
+}
+
+func writeJSON(buf *bytes.Buffer, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	buf.Write(data)
+	return nil
+}
+
+type Sink interface {
+	Write(line []byte) error
+	Sync() error
+	Close() error
+}
+
+type WriterSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewWriterSink(w io.Writer) *WriterSink {
+	return &WriterSink{w: w}
+}
+
+func NewStdoutSink() *WriterSink {
+	return NewWriterSink(os.Stdout)
+}
+
+func (s *WriterSink) Write(line []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err := s.w.Write(line)
+	return err
+}
+
+func (s *WriterSink) Sync() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// Terminals and pipes cannot be fsynced, so only regular files are.
+	if f, ok := s.w.(*os.File); ok {
+		if info, err := f.Stat(); err == nil && info.Mode().IsRegular() {
+			return f.Sync()
+		}
+	}
+	return nil
+}
+
+func (s *WriterSink) Close() error {
+	return s.Sync()
+}
+
+type MemorySink struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func NewMemorySink() *MemorySink {
+	return &MemorySink{}
+}
+
+func (s *MemorySink) Write(line []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lines = append(s.lines, strings.TrimSuffix(string(line), "\n"))
+	return nil
+}
+
+func (s *MemorySink) Lines() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.lines...)
+}
+
+func (s *MemorySink) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lines = nil
+}
+
+func (s *MemorySink) Sync() error  { return nil }
+func (s *MemorySink) Close() error { return nil }
+
+// RotatingFileSink appends to path and, once the file would grow past
+// MaxBytes, renames it to path.1 (shifting older backups up to MaxBackups)
+// and starts a new file. If a rotation fails, the sink goes on appending to
+// the current file and tries again on the next write.
+type RotatingFileSink struct {
+	mu         sync.Mutex
+	path       string
+	maxBytes   int64
+	maxBackups int
+	file       *os.File
+	size       int64
+	closed     bool
+}
+
+func NewRotatingFileSink(path string, maxBytes int64, maxBackups int) (*RotatingFileSink, error) {
+	s := &RotatingFileSink{path: path, maxBytes: maxBytes, maxBackups: maxBackups}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *RotatingFileSink) open() error {
+	file, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	s.file, s.size = file, info.Size()
+	return nil
+}
+
+// Write appends line, rotating first if needed. A failed rotation is
+// returned as an error, but the line is still written to the current file.
+func (s *RotatingFileSink) Write(line []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return os.ErrClosed
+	}
+	var rotateErr error
+	if s.file == nil {
+		// An earlier reopen failed.
+		if err := s.open(); err != nil {
+			return err
+		}
+	} else if s.maxBytes > 0 && s.size > 0 && s.size+int64(len(line)) > s.maxBytes {
+		rotateErr = s.rotate()
+		if s.file == nil {
+			return rotateErr
+		}
+	}
+	n, err := s.file.Write(line)
+	s.size += int64(n)
+	return errors.Join(rotateErr, err)
+}
+
+// rotate moves the current file aside and opens a new one. Whatever
+// happens, it reopens path afterwards, which is the old file if it could
+// not be moved.
+func (s *RotatingFileSink) rotate() error {
+	err := s.file.Close()
+	s.file = nil
+	if err == nil {
+		err = s.shiftBackups()
+	}
+	if openErr := s.open(); openErr != nil {
+		return errors.Join(err, openErr)
+	}
+	if err != nil {
+		return fmt.Errorf("rotating %s: %w", s.path, err)
+	}
+	return nil
+}
+
+func (s *RotatingFileSink) shiftBackups() error {
+	if s.maxBackups <= 0 {
+		if err := os.Remove(s.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	os.Remove(fmt.Sprintf("%s.%d", s.path, s.maxBackups))
+	for i := s.maxBackups - 1; i >= 1; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", s.path, i), fmt.Sprintf("%s.%d", s.path, i+1))
+	}
+	return os.Rename(s.path, s.path+".1")
+}
+
+func (s *RotatingFileSink) Sync() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return nil
+	}
+	return s.file.Sync()
+}
+
+func (s *RotatingFileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
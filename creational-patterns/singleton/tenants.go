@@ -0,0 +1,122 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrUnknownTenant = errors.New("unknown tenant")
+
+// TenantConfigs holds one ConfigManager per tenant name.
+type TenantConfigs = Multiton[string, *ConfigManager]
+
+// TenantDatabases holds one Database per connection string, so tenants
+// that share a database share its pool.
+type TenantDatabases = Multiton[string, *Database]
+
+// registerTenantServices adds the tenant multitons to r. A tenant's
+// configuration is the global configuration with the keys under
+// tenants.<name> laid over it, so tenants.acme.database.dsn becomes
+// database.dsn for acme. A tenant with no such keys is unknown.
+func registerTenantServices(r *ServiceRegistry) {
+	Provide(r, LifetimeSingleton, func(c Container) (*TenantConfigs, error) {
+		global, err := Resolve[*ConfigManager](c)
+		if err != nil {
+			return nil, err
+		}
+		configs := NewMultiton(func(tenant string) (*ConfigManager, error) {
+			return newTenantConfig(global, tenant)
+		})
+		// Rebuild a tenant's configuration on its next use after the
+		// global values it was derived from change.
+		global.Subscribe(func(changes []ConfigChange) {
+			for _, stats := range configs.Stats() {
+				for _, change := range changes {
+					if !strings.HasPrefix(change.Key, "tenants.") || strings.HasPrefix(change.Key, "tenants."+stats.Key+".") {
+						configs.Remove(stats.Key)
+						break
+					}
+				}
+			}
+		})
+		return configs, nil
+	})
+	Provide(r, LifetimeSingleton, func(c Container) (*TenantDatabases, error) {
+		metrics, err := Resolve[*MetricsRegistry](c)
+		if err != nil {
+			return nil, err
+		}
+		databases := NewMultiton(func(dsn string) (*Database, error) {
+			fmt.Printf("[Multiton] Creating database instance for %s\n", dsnName(dsn))
+			db := newDatabase(dsn)
+			db.Instrument(metrics)
+			return db, nil
+		})
+		databases.SetBusyCheck(func(db *Database) bool { return db.pool.Stats().InUse > 0 })
+		databases.SetOnEvict(func(dsn string, db *Database) {
+			db.Uninstrument(metrics)
+			fmt.Printf("[Multiton] Closed database instance for %s\n", db.name)
+		})
+		metrics.GaugeFunc("tenant_database_instances", "Tenant database instances currently open.", nil,
+			func() float64 { return float64(databases.Len()) })
+		return databases, nil
+	})
+}
+
+func newTenantConfig(global *ConfigManager, tenant string) (*ConfigManager, error) {
+	prefix := "tenants." + tenant + "."
+	defaults := make(map[string]string)
+	var secrets []string
+	overlay := false
+	for k, v := range global.values() {
+		key := k
+		if rest, ok := strings.CutPrefix(k, prefix); ok {
+			key, overlay = rest, true
+		} else if strings.HasPrefix(k, "tenants.") {
+			continue
+		} else if _, shadowed := defaults[k]; shadowed {
+			continue
+		}
+		defaults[key] = v
+		if global.IsSecret(k) {
+			secrets = append(secrets, key)
+		}
+	}
+	if !overlay {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownTenant, tenant)
+	}
+	config := NewConfigManager()
+	config.MarkSecret(secrets...)
+	if err := config.Load(LoadOptions{Defaults: defaults}); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+func GetTenantConfig(tenant string) (*ConfigManager, error) {
+	configs, err := Resolve[*TenantConfigs](defaultServices)
+	if err != nil {
+		return nil, err
+	}
+	return configs.Get(tenant)
+}
+
+// GetTenantDatabase returns the database named by the tenant's
+// database.dsn setting. The database stays open until release is called,
+// even if it is evicted or the tenant's configuration changes meanwhile.
+func GetTenantDatabase(tenant string) (db *Database, release func() error, err error) {
+	config, err := GetTenantConfig(tenant)
+	if err != nil {
+		return nil, nil, err
+	}
+	dsn, err := config.GetString("database.dsn")
+	if err != nil {
+		return nil, nil, fmt.Errorf("tenant %s: %w", tenant, err)
+	}
+	databases, err := Resolve[*TenantDatabases](defaultServices)
+	if err != nil {
+		return nil, nil, err
+	}
+	return databases.Acquire(dsn)
+}